@@ -0,0 +1,115 @@
+package gnom
+
+type (
+	GrammarAnalysis struct {
+		rules        []GrammarRule
+		start        GrammarSym
+		eof          GrammarSym
+		nonTerminals *changeIntSet
+		nullableSet  *changeIntSet
+		firstSet     *changeIntIntSet
+		followSet    *changeIntIntSet
+	}
+)
+
+// NewGrammarAnalysis computes the nullable, FIRST, and FOLLOW sets of a
+// grammar
+func NewGrammarAnalysis(rules []GrammarRule, start, eof GrammarSym) *GrammarAnalysis {
+	nonTerminals := newChangeIntSet()
+	for _, i := range rules {
+		nonTerminals.upsert(i.from)
+	}
+	nullableSet := calcLL1NullableSet(rules)
+	firstSet := calcLL1FirstSet(rules, nullableSet)
+	followSet := calcLL1FollowSet(rules, start.Kind(), eof.Kind(), firstSet, nullableSet)
+	return &GrammarAnalysis{
+		rules:        rules,
+		start:        start,
+		eof:          eof,
+		nonTerminals: nonTerminals,
+		nullableSet:  nullableSet,
+		firstSet:     firstSet,
+		followSet:    followSet,
+	}
+}
+
+func symsFromSet(set map[int]struct{}, term bool) []GrammarSym {
+	syms := make([]GrammarSym, 0, len(set))
+	for _, i := range sortedIntSet(set) {
+		syms = append(syms, GrammarSym{
+			term: term,
+			kind: i,
+		})
+	}
+	return syms
+}
+
+func (a *GrammarAnalysis) Rules() []GrammarRule {
+	return a.rules
+}
+
+func (a *GrammarAnalysis) Start() GrammarSym {
+	return a.start
+}
+
+func (a *GrammarAnalysis) EOF() GrammarSym {
+	return a.eof
+}
+
+// NonTerms returns the nonterminals with production rules sorted by kind
+func (a *GrammarAnalysis) NonTerms() []GrammarSym {
+	return symsFromSet(a.nonTerminals.iter(), false)
+}
+
+// Terms returns the terminals used by the grammar, including eof, sorted by
+// kind
+func (a *GrammarAnalysis) Terms() []GrammarSym {
+	set := map[int]struct{}{
+		a.eof.kind: {},
+	}
+	for _, i := range a.rules {
+		for _, j := range i.to {
+			if j.term {
+				set[j.kind] = struct{}{}
+			}
+		}
+	}
+	return symsFromSet(set, true)
+}
+
+// Nullable returns true if the symbol derives the empty string
+func (a *GrammarAnalysis) Nullable(sym GrammarSym) bool {
+	if sym.term {
+		return false
+	}
+	return a.nullableSet.contains(sym.kind)
+}
+
+// NullableSet returns the nullable nonterminals sorted by kind
+func (a *GrammarAnalysis) NullableSet() []GrammarSym {
+	return symsFromSet(a.nullableSet.iter(), false)
+}
+
+// First returns the terminals that may begin a string derived from the
+// symbol sorted by kind
+func (a *GrammarAnalysis) First(sym GrammarSym) []GrammarSym {
+	if sym.term {
+		return []GrammarSym{sym}
+	}
+	return symsFromSet(a.firstSet.iter(sym.kind), true)
+}
+
+// FirstOf returns the terminals that may begin a string derived from the
+// sequence of symbols sorted by kind, and whether the sequence is nullable
+func (a *GrammarAnalysis) FirstOf(syms []GrammarSym) ([]GrammarSym, bool) {
+	return symsFromSet(calcLL1First(syms, a.firstSet, a.nullableSet), true), isLL1Nullable(syms, a.nullableSet)
+}
+
+// Follow returns the terminals that may follow the nonterminal in a sentence
+// sorted by kind
+func (a *GrammarAnalysis) Follow(sym GrammarSym) []GrammarSym {
+	if sym.term {
+		return []GrammarSym{}
+	}
+	return symsFromSet(a.followSet.iter(sym.kind), true)
+}
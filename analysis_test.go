@@ -0,0 +1,109 @@
+package gnom
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestGrammarAnalysis(t *testing.T) {
+	assert := assert.New(t)
+
+	g := NewGrammarSymGenerator()
+
+	S := g.NonTerm()
+	eof := g.Term()
+
+	T := g.NonTerm()
+	SP := g.NonTerm()
+	TP := g.NonTerm()
+	F := g.NonTerm()
+	num := g.Term()
+	plus := g.Term()
+	star := g.Term()
+	lparen := g.Term()
+	rparen := g.Term()
+
+	a := NewGrammarAnalysis([]GrammarRule{
+		NewGrammarRule(S, T, SP),
+		NewGrammarRule(SP, plus, T, SP),
+		NewGrammarRule(SP),
+		NewGrammarRule(T, F, TP),
+		NewGrammarRule(TP, star, F, TP),
+		NewGrammarRule(TP),
+		NewGrammarRule(F, num),
+		NewGrammarRule(F, lparen, S, rparen),
+	}, S, eof)
+
+	assert.Equal([]GrammarSym{S, T, SP, TP, F}, a.NonTerms())
+	assert.Equal([]GrammarSym{eof, num, plus, star, lparen, rparen}, a.Terms())
+	assert.Equal([]GrammarSym{SP, TP}, a.NullableSet())
+	assert.True(a.Nullable(SP))
+	assert.False(a.Nullable(S))
+	assert.False(a.Nullable(plus))
+
+	for n, c := range []struct {
+		sym    GrammarSym
+		first  []GrammarSym
+		follow []GrammarSym
+	}{
+		{
+			sym:    S,
+			first:  []GrammarSym{num, lparen},
+			follow: []GrammarSym{eof, rparen},
+		},
+		{
+			sym:    SP,
+			first:  []GrammarSym{plus},
+			follow: []GrammarSym{eof, rparen},
+		},
+		{
+			sym:    T,
+			first:  []GrammarSym{num, lparen},
+			follow: []GrammarSym{eof, plus, rparen},
+		},
+		{
+			sym:    TP,
+			first:  []GrammarSym{star},
+			follow: []GrammarSym{eof, plus, rparen},
+		},
+		{
+			sym:    F,
+			first:  []GrammarSym{num, lparen},
+			follow: []GrammarSym{eof, plus, star, rparen},
+		},
+		{
+			sym:    star,
+			first:  []GrammarSym{star},
+			follow: []GrammarSym{},
+		},
+	} {
+		assert.Equalf(c.first, a.First(c.sym), "Fail case %d", n)
+		assert.Equalf(c.follow, a.Follow(c.sym), "Fail case %d", n)
+	}
+
+	for n, c := range []struct {
+		syms     []GrammarSym
+		first    []GrammarSym
+		nullable bool
+	}{
+		{
+			syms:     []GrammarSym{SP, TP},
+			first:    []GrammarSym{plus, star},
+			nullable: true,
+		},
+		{
+			syms:     []GrammarSym{TP, SP, rparen},
+			first:    []GrammarSym{plus, star, rparen},
+			nullable: false,
+		},
+		{
+			syms:     []GrammarSym{},
+			first:    []GrammarSym{},
+			nullable: true,
+		},
+	} {
+		first, nullable := a.FirstOf(c.syms)
+		assert.Equalf(c.first, first, "Fail case %d", n)
+		assert.Equalf(c.nullable, nullable, "Fail case %d", n)
+	}
+}
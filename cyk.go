@@ -0,0 +1,276 @@
+package gnom
+
+import (
+	"fmt"
+)
+
+type (
+	CYKParser struct {
+		transform *GrammarTransform
+		start     GrammarSym
+		eof       GrammarSym
+		nullable  bool
+		terms     map[int][]int
+		pairs     []cykPair
+	}
+
+	cykPair struct {
+		from  int
+		left  int
+		right int
+	}
+
+	cykEntry struct {
+		split int
+		left  int
+		right int
+	}
+)
+
+// NewCYKParser creates a parser for an arbitrary context free grammar, which
+// is converted to Chomsky normal form. Parsing takes cubic time in the number
+// of tokens.
+func NewCYKParser(rules []GrammarRule, start, eof GrammarSym) (*CYKParser, error) {
+	if err := checkGrammarErr(CheckGrammar(rules, start, eof)); err != nil {
+		return nil, err
+	}
+	tf := ToCNF(rules, start)
+	cnfStart := tf.Start()
+	nullable := false
+	terms := map[int][]int{}
+	pairs := []cykPair{}
+	for _, i := range tf.Rules() {
+		switch len(i.to) {
+		case 0:
+			nullable = true
+		case 1:
+			terms[i.to[0].kind] = append(terms[i.to[0].kind], i.from)
+		case 2:
+			pairs = append(pairs, cykPair{
+				from:  i.from,
+				left:  i.to[0].kind,
+				right: i.to[1].kind,
+			})
+		default:
+			return nil, fmt.Errorf("Grammar not in Chomsky normal form: %w", ErrGrammar)
+		}
+	}
+	return &CYKParser{
+		transform: tf,
+		start:     cnfStart,
+		eof:       eof,
+		nullable:  nullable,
+		terms:     terms,
+		pairs:     pairs,
+	}, nil
+}
+
+func NewCYKParserFromGrammar(g *Grammar) (*CYKParser, error) {
+	return NewCYKParser(g.rules, g.start, g.eof)
+}
+
+func (p *CYKParser) stripEOF(tokens []Token) ([]Token, error) {
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("Unexpected end of token stream: %w", ErrParse)
+	}
+	last := tokens[len(tokens)-1]
+	if last.Kind() != p.eof.Kind() {
+		return nil, fmt.Errorf("Unexpected end of token stream: %w", ErrParse)
+	}
+	// an EOF token before the end derives from no nonterminal, and so is
+	// rejected by the table
+	return tokens[:len(tokens)-1], nil
+}
+
+// table returns the CYK table where table[l-1][i] contains the nonterminals
+// deriving the l tokens starting at index i
+func (p *CYKParser) table(tokens []Token) [][]map[int]cykEntry {
+	n := len(tokens)
+	table := make([][]map[int]cykEntry, n)
+	table[0] = make([]map[int]cykEntry, n)
+	for i, t := range tokens {
+		cell := map[int]cykEntry{}
+		for _, j := range p.terms[t.Kind()] {
+			cell[j] = cykEntry{
+				split: 0,
+			}
+		}
+		table[0][i] = cell
+	}
+	for l := 2; l <= n; l++ {
+		table[l-1] = make([]map[int]cykEntry, n-l+1)
+		for i := 0; i+l <= n; i++ {
+			cell := map[int]cykEntry{}
+			for k := 1; k < l; k++ {
+				left := table[k-1][i]
+				right := table[l-k-1][i+k]
+				if len(left) == 0 || len(right) == 0 {
+					continue
+				}
+				for _, r := range p.pairs {
+					if _, ok := cell[r.from]; ok {
+						continue
+					}
+					if _, ok := left[r.left]; !ok {
+						continue
+					}
+					if _, ok := right[r.right]; !ok {
+						continue
+					}
+					cell[r.from] = cykEntry{
+						split: k,
+						left:  r.left,
+						right: r.right,
+					}
+				}
+			}
+			table[l-1][i] = cell
+		}
+	}
+	return table
+}
+
+// prefixes returns for each start i < end the nonterminals which derive a
+// string beginning with the tokens from i to end, where the token at end-1 is
+// of the kind last, which need not be the kind of the token in the table
+func (p *CYKParser) prefixes(table [][]map[int]cykEntry, end int, last int) []map[int]struct{} {
+	cols := make([]map[int]struct{}, end)
+	for i := end - 1; i >= 0; i-- {
+		col := map[int]struct{}{}
+		if i == end-1 {
+			for _, j := range p.terms[last] {
+				col[j] = struct{}{}
+			}
+		} else {
+			for k := 1; i+k < end; k++ {
+				left := table[k-1][i]
+				right := cols[i+k]
+				if len(left) == 0 || len(right) == 0 {
+					continue
+				}
+				for _, r := range p.pairs {
+					if _, ok := left[r.left]; !ok {
+						continue
+					}
+					if _, ok := right[r.right]; !ok {
+						continue
+					}
+					col[r.from] = struct{}{}
+				}
+			}
+		}
+		// a nonterminal whose left child derives a string beginning with the
+		// tokens does as well
+		for changed := true; changed; {
+			changed = false
+			for _, r := range p.pairs {
+				if _, ok := col[r.from]; ok {
+					continue
+				}
+				if _, ok := col[r.left]; ok {
+					col[r.from] = struct{}{}
+					changed = true
+				}
+			}
+		}
+		cols[i] = col
+	}
+	return cols
+}
+
+// parseError returns an error at the first token at which the tokens are no
+// longer a prefix of a sentence, which expects the terminals that continue
+// the prefix before it
+func (p *CYKParser) parseError(table [][]map[int]cykEntry, tokens []Token, eofToken Token) *ParseError {
+	l := 0
+	for ; l < len(tokens); l++ {
+		if _, ok := p.prefixes(table, l+1, tokens[l].Kind())[0][p.start.kind]; !ok {
+			break
+		}
+	}
+	sentence := p.nullable
+	if l > 0 {
+		_, sentence = table[l-1][0][p.start.kind]
+	}
+	token := eofToken
+	if l < len(tokens) {
+		token = tokens[l]
+	}
+	if sentence && token.Kind() == p.eof.kind {
+		// the tokens after an EOF token before the end are unexpected
+		next := eofToken
+		if l+1 < len(tokens) {
+			next = tokens[l+1]
+		}
+		return &ParseError{
+			pos:      l + 1,
+			token:    next,
+			expected: []GrammarSym{},
+		}
+	}
+	expected := map[int]struct{}{}
+	if sentence {
+		expected[p.eof.kind] = struct{}{}
+	}
+	for k := range p.terms {
+		if _, ok := p.prefixes(table, l+1, k)[0][p.start.kind]; ok {
+			expected[k] = struct{}{}
+		}
+	}
+	return &ParseError{
+		pos:      l,
+		token:    token,
+		expected: symsFromSet(expected, true),
+	}
+}
+
+func (p *CYKParser) buildTree(table [][]map[int]cykEntry, tokens []Token, kind int, i, l int) *ParseTree {
+	node := newParseTree(NewGrammarNonTerm(kind))
+	e := table[l-1][i][kind]
+	if e.split == 0 {
+		node.addChild(newParseTreeLeaf(NewGrammarTerm(tokens[i].Kind()), tokens[i]))
+		return node
+	}
+	node.addChild(p.buildTree(table, tokens, e.left, i, e.split))
+	node.addChild(p.buildTree(table, tokens, e.right, i+e.split, l-e.split))
+	return node
+}
+
+// Recognize returns true if the tokens are a sentence of the grammar
+func (p *CYKParser) Recognize(tokens []Token) bool {
+	tokens, err := p.stripEOF(tokens)
+	if err != nil {
+		return false
+	}
+	if len(tokens) == 0 {
+		return p.nullable
+	}
+	_, ok := p.table(tokens)[len(tokens)-1][0][p.start.Kind()]
+	return ok
+}
+
+// Parse parses the tokens. If the tokens are not a sentence, the error is a
+// *ParseError at the first token at which they are no longer a prefix of
+// one, reporting the terminals which may continue the prefix.
+func (p *CYKParser) Parse(tokens []Token) (*ParseTree, error) {
+	all := tokens
+	tokens, err := p.stripEOF(tokens)
+	if err != nil {
+		return nil, err
+	}
+	eofToken := all[len(all)-1]
+	var tree *ParseTree
+	if len(tokens) == 0 {
+		if !p.nullable {
+			return nil, p.parseError(nil, tokens, eofToken)
+		}
+		tree = newParseTree(p.start)
+	} else {
+		table := p.table(tokens)
+		if _, ok := table[len(tokens)-1][0][p.start.Kind()]; !ok {
+			return nil, p.parseError(table, tokens, eofToken)
+		}
+		tree = p.buildTree(table, tokens, p.start.Kind(), 0, len(tokens))
+	}
+	return p.transform.RestoreTree(tree)
+}
@@ -0,0 +1,213 @@
+package gnom
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// checkParseTree verifies that every node of a tree is derived by a rule and
+// returns the tokens at its leaves
+func checkParseTree(rules []GrammarRule, tree *ParseTree) ([]Token, bool) {
+	if tree.Term() {
+		return []Token{tree.Token()}, true
+	}
+	syms := []GrammarSym{}
+	tokens := []Token{}
+	for _, i := range tree.Children() {
+		syms = append(syms, i.Sym())
+		t, ok := checkParseTree(rules, i)
+		if !ok {
+			return nil, false
+		}
+		tokens = append(tokens, t...)
+	}
+	for _, i := range rules {
+		if i.from == tree.Kind() && symsEqual(i.to, syms) {
+			return tokens, true
+		}
+	}
+	return nil, false
+}
+
+func TestCYKParser_Parse(t *testing.T) {
+	assert := assert.New(t)
+
+	g := NewGrammarSymGenerator()
+
+	E := g.NonTerm()
+	eof := g.Term()
+
+	num := g.Term()
+	plus := g.Term()
+	star := g.Term()
+	lparen := g.Term()
+	rparen := g.Term()
+
+	S := g.NonTerm()
+	T := g.NonTerm()
+	SP := g.NonTerm()
+	TP := g.NonTerm()
+	F := g.NonTerm()
+
+	ambiguous := []GrammarRule{
+		NewGrammarRule(E, E, plus, E),
+		NewGrammarRule(E, E, star, E),
+		NewGrammarRule(E, num),
+		NewGrammarRule(E, lparen, E, rparen),
+	}
+	ll1 := []GrammarRule{
+		NewGrammarRule(S, T, SP),
+		NewGrammarRule(SP, plus, T, SP),
+		NewGrammarRule(SP),
+		NewGrammarRule(T, F, TP),
+		NewGrammarRule(TP, star, F, TP),
+		NewGrammarRule(TP),
+		NewGrammarRule(F, num),
+		NewGrammarRule(F, lparen, S, rparen),
+	}
+
+	ambiguousParser, err := NewCYKParser(ambiguous, E, eof)
+	assert.NoErrorf(err, "Failed to create parser: %v", err)
+	ll1Parser, err := NewLL1Parser(ll1, S, eof)
+	assert.NoErrorf(err, "Failed to create parser: %v", err)
+	cykParser, err := NewCYKParser(ll1, S, eof)
+	assert.NoErrorf(err, "Failed to create parser: %v", err)
+
+	for n, c := range []struct {
+		tokens   []Token
+		err      error
+		pos      int
+		expected []GrammarSym
+	}{
+		{
+			tokens: []Token{
+				newToken(num.Kind(), "1"),
+				newToken(plus.Kind(), "+"),
+				newToken(num.Kind(), "2"),
+				newToken(star.Kind(), "*"),
+				newToken(lparen.Kind(), "("),
+				newToken(num.Kind(), "3"),
+				newToken(plus.Kind(), "+"),
+				newToken(num.Kind(), "4"),
+				newToken(rparen.Kind(), ")"),
+				newToken(eof.Kind(), ""),
+			},
+		},
+		{
+			tokens: []Token{
+				newToken(num.Kind(), "1"),
+				newToken(eof.Kind(), ""),
+			},
+		},
+		{
+			tokens: []Token{
+				newToken(num.Kind(), "1"),
+				newToken(plus.Kind(), "+"),
+				newToken(eof.Kind(), ""),
+			},
+			err:      ErrParse,
+			pos:      2,
+			expected: []GrammarSym{num, lparen},
+		},
+		{
+			tokens: []Token{
+				newToken(eof.Kind(), ""),
+			},
+			err:      ErrParse,
+			pos:      0,
+			expected: []GrammarSym{num, lparen},
+		},
+		{
+			tokens: []Token{
+				newToken(num.Kind(), "1"),
+				newToken(rparen.Kind(), ")"),
+				newToken(num.Kind(), "2"),
+				newToken(eof.Kind(), ""),
+			},
+			err:      ErrParse,
+			pos:      1,
+			expected: []GrammarSym{eof, plus, star},
+		},
+		{
+			tokens: []Token{
+				newToken(lparen.Kind(), "("),
+				newToken(num.Kind(), "1"),
+				newToken(num.Kind(), "2"),
+				newToken(rparen.Kind(), ")"),
+				newToken(eof.Kind(), ""),
+			},
+			err:      ErrParse,
+			pos:      2,
+			expected: []GrammarSym{plus, star, rparen},
+		},
+		{
+			tokens: []Token{
+				newToken(num.Kind(), "1"),
+				newToken(eof.Kind(), ""),
+				newToken(num.Kind(), "2"),
+				newToken(eof.Kind(), ""),
+			},
+			err:      ErrParse,
+			pos:      2,
+			expected: []GrammarSym{},
+		},
+		{
+			tokens: []Token{
+				newToken(num.Kind(), "1"),
+			},
+			err: ErrParse,
+		},
+	} {
+		tree, err := ambiguousParser.Parse(c.tokens)
+		if c.err != nil {
+			assert.Errorf(err, "Should fail to parse: case %d", n)
+			assert.Truef(errors.Is(err, c.err), "Should fail to parse: case %d", n)
+			var perr *ParseError
+			if c.expected != nil && assert.Truef(errors.As(err, &perr), "Should report expected terminals: case %d", n) {
+				assert.Equalf(c.pos, perr.Pos(), "Fail case %d", n)
+				assert.Equalf(c.tokens[c.pos], perr.Token(), "Fail case %d", n)
+				assert.Equalf(c.expected, perr.Expected(), "Fail case %d", n)
+				_, ok := perr.NonTerm()
+				assert.Falsef(ok, "Fail case %d", n)
+			}
+			assert.Falsef(ambiguousParser.Recognize(c.tokens), "Should fail to recognize: case %d", n)
+			_, err = cykParser.Parse(c.tokens)
+			assert.Errorf(err, "Should fail to parse: case %d", n)
+			continue
+		}
+		assert.NoErrorf(err, "Failed to parse: case %d, %v", n, err)
+		assert.Truef(ambiguousParser.Recognize(c.tokens), "Failed to recognize: case %d", n)
+		tokens, ok := checkParseTree(ambiguous, tree)
+		assert.Truef(ok, "Parse tree does not follow grammar: case %d", n)
+		assert.Equalf(c.tokens[:len(c.tokens)-1], tokens, "Parse tree does not match tokens: case %d", n)
+
+		expTree, err := ll1Parser.Parse(c.tokens)
+		assert.NoErrorf(err, "Failed to parse: case %d, %v", n, err)
+		tree, err = cykParser.Parse(c.tokens)
+		assert.NoErrorf(err, "Failed to parse: case %d, %v", n, err)
+		assert.Equalf(parseTreeString(expTree), parseTreeString(tree), "Fail case %d", n)
+	}
+
+	nullableParser, err := NewCYKParser([]GrammarRule{
+		NewGrammarRule(S, lparen, S, rparen, S),
+		NewGrammarRule(S),
+	}, S, eof)
+	assert.NoErrorf(err, "Failed to create parser: %v", err)
+	tree, err := nullableParser.Parse([]Token{
+		newToken(eof.Kind(), ""),
+	})
+	assert.NoErrorf(err, "Failed to parse: %v", err)
+	assert.Equal("7()", parseTreeString(tree))
+	tree, err = nullableParser.Parse([]Token{
+		newToken(lparen.Kind(), "("),
+		newToken(lparen.Kind(), "("),
+		newToken(rparen.Kind(), ")"),
+		newToken(rparen.Kind(), ")"),
+		newToken(lparen.Kind(), "("),
+		newToken(rparen.Kind(), ")"),
+		newToken(eof.Kind(), ""),
+	})
+	assert.NoErrorf(err, "Failed to parse: %v", err)
+	assert.Equal("7(( 7(( 7() ) 7()) ) 7(( 7() ) 7()))", parseTreeString(tree))
+}
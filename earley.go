@@ -0,0 +1,435 @@
+package gnom
+
+import (
+	"fmt"
+	"sort"
+)
+
+type (
+	// EarleyError is the error of an unexpected token returned by
+	// EarleyParser, which is the ParseError shared by every parser
+	EarleyError = ParseError
+
+	EarleyParser struct {
+		rules    []GrammarRule
+		ruleMap  map[int][]int
+		nullable *changeIntSet
+		start    GrammarSym
+		eof      GrammarSym
+	}
+
+	earleyItem struct {
+		rule   int
+		dot    int
+		origin int
+	}
+
+	// earleyLeo is a transitive item of Leo's optimization. When a
+	// nonterminal completes in a set where the only item waiting on it ends
+	// with it, the chain of completions up to top is deterministic and only
+	// top is added to the completing set.
+	earleyLeo struct {
+		item earleyItem
+		top  earleyItem
+		next *earleyLeo
+	}
+
+	earleyCompletion struct {
+		nonTerm int
+		origin  int
+	}
+
+	earleySet struct {
+		items     []earleyItem
+		index     map[earleyItem]struct{}
+		waiting   map[int][]earleyItem
+		completed map[earleyCompletion][]int
+		leo       map[int]*earleyLeo
+		// leoChains are the unexpanded rest of the chains used to complete
+		// items of the set, whose intermediate completions are added to
+		// completed only when looked up
+		leoChains []*earleyLeo
+	}
+
+	earleyChart struct {
+		p      *EarleyParser
+		tokens []Token
+		sets   []*earleySet
+		// waits are the sets in which each item waiting on a nonterminal is
+		// found in increasing order
+		waits map[earleyItem][]int
+	}
+)
+
+// NewEarleyParser creates an Earley parser, which accepts any grammar,
+// including left recursive and ambiguous grammars
+func NewEarleyParser(rules []GrammarRule, start, eof GrammarSym) (*EarleyParser, error) {
+	if err := checkGrammarErr(CheckGrammar(rules, start, eof)); err != nil {
+		return nil, err
+	}
+	ruleMap := map[int][]int{}
+	for n, i := range rules {
+		ruleMap[i.from] = append(ruleMap[i.from], n)
+	}
+	return &EarleyParser{
+		rules:    rules,
+		ruleMap:  ruleMap,
+		nullable: calcLL1NullableSet(rules),
+		start:    start,
+		eof:      eof,
+	}, nil
+}
+
+func NewEarleyParserFromGrammar(g *Grammar) (*EarleyParser, error) {
+	return NewEarleyParser(g.rules, g.start, g.eof)
+}
+
+func newEarleySet() *earleySet {
+	return &earleySet{
+		items:     []earleyItem{},
+		index:     map[earleyItem]struct{}{},
+		waiting:   map[int][]earleyItem{},
+		completed: map[earleyCompletion][]int{},
+		leo:       map[int]*earleyLeo{},
+		leoChains: []*earleyLeo{},
+	}
+}
+
+func (s *earleySet) add(i earleyItem) {
+	if _, ok := s.index[i]; ok {
+		return
+	}
+	s.index[i] = struct{}{}
+	s.items = append(s.items, i)
+}
+
+func (s *earleySet) contains(i earleyItem) bool {
+	_, ok := s.index[i]
+	return ok
+}
+
+// addCompleted adds the completion of an item to the set, and returns true
+// if the nonterminal was already completed from the same origin
+func (c *earleyChart) addCompleted(s *earleySet, i earleyItem) bool {
+	k := earleyCompletion{
+		nonTerm: c.p.rules[i.rule].from,
+		origin:  i.origin,
+	}
+	rules, ok := s.completed[k]
+	for _, j := range rules {
+		if j == i.rule {
+			return ok
+		}
+	}
+	s.completed[k] = append(rules, i.rule)
+	return ok
+}
+
+// leo returns the transitive item of set i for the nonterminal, if any
+func (c *earleyChart) leo(i int, nonTerm int) *earleyLeo {
+	s := c.sets[i]
+	if l, ok := s.leo[nonTerm]; ok {
+		return l
+	}
+	s.leo[nonTerm] = nil
+	waiting := s.waiting[nonTerm]
+	if len(waiting) != 1 {
+		return nil
+	}
+	item := waiting[0]
+	r := c.p.rules[item.rule]
+	if item.dot != len(r.to)-1 {
+		return nil
+	}
+	l := &earleyLeo{
+		item: item,
+		top: earleyItem{
+			rule:   item.rule,
+			dot:    item.dot + 1,
+			origin: item.origin,
+		},
+	}
+	if item.origin < i {
+		if next := c.leo(item.origin, r.from); next != nil {
+			l.top = next.top
+			l.next = next
+		}
+	}
+	s.leo[nonTerm] = l
+	return l
+}
+
+// process completes set j by predicting, completing, and scanning its items
+func (c *earleyChart) process(j int) {
+	s := c.sets[j]
+	predicted := map[int]struct{}{}
+	chains := map[*earleyLeo]struct{}{}
+	for n := 0; n < len(s.items); n++ {
+		i := s.items[n]
+		r := c.p.rules[i.rule]
+		if i.dot < len(r.to) {
+			sym := r.to[i.dot]
+			next := earleyItem{
+				rule:   i.rule,
+				dot:    i.dot + 1,
+				origin: i.origin,
+			}
+			if sym.term {
+				if j < len(c.tokens) && c.tokens[j].Kind() == sym.kind {
+					c.sets[j+1].add(next)
+				}
+				continue
+			}
+			s.waiting[sym.kind] = append(s.waiting[sym.kind], i)
+			c.waits[i] = append(c.waits[i], j)
+			if _, ok := predicted[sym.kind]; !ok {
+				predicted[sym.kind] = struct{}{}
+				for _, k := range c.p.ruleMap[sym.kind] {
+					s.add(earleyItem{
+						rule:   k,
+						dot:    0,
+						origin: j,
+					})
+				}
+			}
+			// a nullable nonterminal may be skipped immediately, as its
+			// completion may precede items waiting on it
+			if c.p.nullable.contains(sym.kind) {
+				s.add(next)
+			}
+			continue
+		}
+		c.addCompleted(s, i)
+		if i.origin < j {
+			if l := c.leo(i.origin, r.from); l != nil {
+				s.add(l.top)
+				if _, ok := chains[l]; !ok {
+					chains[l] = struct{}{}
+					s.leoChains = append(s.leoChains, l)
+				}
+				continue
+			}
+		}
+		for _, k := range c.sets[i.origin].waiting[r.from] {
+			s.add(earleyItem{
+				rule:   k.rule,
+				dot:    k.dot + 1,
+				origin: k.origin,
+			})
+		}
+	}
+}
+
+// expandLeo adds the intermediate completions of the Leo chains of set j
+// from origins down to the given origin. The origins of a chain decrease
+// along it, and once a completion is already in the set, the rest of the
+// chain is that of another chain of the set.
+func (c *earleyChart) expandLeo(j int, origin int) {
+	s := c.sets[j]
+	for n, l := range s.leoChains {
+		for l != nil && l.item.origin >= origin {
+			found := c.addCompleted(s, earleyItem{
+				rule:   l.item.rule,
+				dot:    l.item.dot + 1,
+				origin: l.item.origin,
+			})
+			l = l.next
+			if found {
+				l = nil
+			}
+		}
+		s.leoChains[n] = l
+	}
+}
+
+// completedRules returns the rules of the nonterminal deriving the tokens from
+// origin up to j
+func (c *earleyChart) completedRules(j int, nonTerm int, origin int) []int {
+	c.expandLeo(j, origin)
+	return c.sets[j].completed[earleyCompletion{
+		nonTerm: nonTerm,
+		origin:  origin,
+	}]
+}
+
+// splits returns the boundaries between the first d symbols of a rule
+// starting at origin and ending at k
+func (c *earleyChart) splits(rule int, d int, origin int, k int) [][]int {
+	if d == 0 {
+		if k != origin {
+			return nil
+		}
+		return [][]int{{origin}}
+	}
+	prefix := earleyItem{
+		rule:   rule,
+		dot:    d - 1,
+		origin: origin,
+	}
+	sym := c.p.rules[rule].to[d-1]
+	splits := [][]int{}
+	extend := func(m int) {
+		if !c.sets[m].contains(prefix) {
+			return
+		}
+		for _, i := range c.splits(rule, d-1, origin, m) {
+			splits = append(splits, append(i, k))
+		}
+	}
+	if sym.term {
+		if k > origin && c.tokens[k-1].Kind() == sym.kind {
+			extend(k - 1)
+		}
+		return splits
+	}
+	// the latest boundaries are tried first
+	waits := c.waits[prefix]
+	for n := sort.SearchInts(waits, k+1) - 1; n >= 0; n-- {
+		if len(c.completedRules(k, sym.kind, waits[n])) > 0 {
+			extend(waits[n])
+		}
+	}
+	return splits
+}
+
+// forest builds the forest of the derivations of the tokens from the start
+// symbol
+func (c *earleyChart) forest() *ParseForest {
+	nodes := map[sppfKey]*SPPFNode{}
+	queue := []*SPPFNode{}
+	node := func(sym GrammarSym, start, end int) *SPPFNode {
+		k := sppfKey{
+			kind:  sym.kind,
+			start: start,
+			end:   end,
+		}
+		if n, ok := nodes[k]; ok {
+			return n
+		}
+		n := &SPPFNode{
+			id:    len(nodes),
+			sym:   sym,
+			start: start,
+			end:   end,
+			alts:  []*SPPFAlternative{},
+			keys:  map[string]struct{}{},
+		}
+		if sym.term {
+			n.token = c.tokens[start]
+		} else {
+			queue = append(queue, n)
+		}
+		nodes[k] = n
+		return n
+	}
+	root := node(c.p.start, 0, len(c.tokens))
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		for _, i := range c.completedRules(n.end, n.sym.kind, n.start) {
+			r := c.p.rules[i]
+			for _, j := range c.splits(i, len(r.to), n.start, n.end) {
+				children := make([]*SPPFNode, 0, len(r.to))
+				for m, k := range r.to {
+					children = append(children, node(k, j[m], j[m+1]))
+				}
+				n.addAlternative(i, children)
+			}
+		}
+	}
+	return &ParseForest{
+		root:  root,
+		rules: c.p.rules,
+	}
+}
+
+// expected returns the terminals which may be scanned in set j
+func (c *earleyChart) expected(j int) []GrammarSym {
+	set := map[int]struct{}{}
+	for _, i := range c.sets[j].items {
+		r := c.p.rules[i.rule]
+		if i.dot < len(r.to) && r.to[i.dot].term {
+			set[r.to[i.dot].kind] = struct{}{}
+		}
+	}
+	if len(c.completedRules(j, c.p.start.kind, 0)) > 0 {
+		set[c.p.eof.kind] = struct{}{}
+	}
+	return symsFromSet(set, true)
+}
+
+func (p *EarleyParser) chart(tokens []Token) (*earleyChart, error) {
+	end := -1
+	for n, i := range tokens {
+		if i.Kind() == p.eof.kind {
+			end = n
+			break
+		}
+	}
+	if end < 0 {
+		return nil, fmt.Errorf("Unexpected end of token stream: %w", ErrParse)
+	}
+	c := &earleyChart{
+		p:      p,
+		tokens: tokens[:end],
+		sets:   make([]*earleySet, end+1),
+		waits:  map[earleyItem][]int{},
+	}
+	for n := range c.sets {
+		c.sets[n] = newEarleySet()
+	}
+	for _, i := range p.ruleMap[p.start.kind] {
+		c.sets[0].add(earleyItem{
+			rule:   i,
+			dot:    0,
+			origin: 0,
+		})
+	}
+	for j := 0; j <= end; j++ {
+		c.process(j)
+		if j < end && len(c.sets[j+1].items) == 0 {
+			return nil, &ParseError{
+				pos:      j,
+				token:    tokens[j],
+				expected: c.expected(j),
+			}
+		}
+	}
+	if len(c.completedRules(end, p.start.kind, 0)) == 0 {
+		return nil, &ParseError{
+			pos:      end,
+			token:    tokens[end],
+			expected: c.expected(end),
+		}
+	}
+	return c, nil
+}
+
+// Recognize returns nil if the tokens are derivable from the start symbol
+func (p *EarleyParser) Recognize(tokens []Token) error {
+	_, err := p.chart(tokens)
+	return err
+}
+
+// ParseForest returns every derivation of the tokens from the start symbol
+func (p *EarleyParser) ParseForest(tokens []Token) (*ParseForest, error) {
+	c, err := p.chart(tokens)
+	if err != nil {
+		return nil, err
+	}
+	return c.forest(), nil
+}
+
+// Parse returns the first parse tree of the tokens. For ambiguous input,
+// every tree may be enumerated from ParseForest.
+func (p *EarleyParser) Parse(tokens []Token) (*ParseTree, error) {
+	forest, err := p.ParseForest(tokens)
+	if err != nil {
+		return nil, err
+	}
+	trees := forest.Trees(1)
+	if len(trees) == 0 {
+		return nil, fmt.Errorf("Unexpected parse forest shape: %w", ErrParseInternal)
+	}
+	return trees[0], nil
+}
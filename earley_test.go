@@ -0,0 +1,250 @@
+package gnom
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestEarleyParser_Parse(t *testing.T) {
+	assert := assert.New(t)
+
+	g := NewGrammarSymGenerator()
+
+	E := g.NonTerm()
+	eof := g.Term()
+
+	T := g.NonTerm()
+	F := g.NonTerm()
+	num := g.Term()
+	plus := g.Term()
+	star := g.Term()
+	lparen := g.Term()
+	rparen := g.Term()
+	S := g.NonTerm()
+	A := g.NonTerm()
+	b := g.Term()
+	c := g.Term()
+
+	exprRules := []GrammarRule{
+		NewGrammarRule(E, E, plus, T),
+		NewGrammarRule(E, T),
+		NewGrammarRule(T, T, star, F),
+		NewGrammarRule(T, F),
+		NewGrammarRule(F, num),
+		NewGrammarRule(F, lparen, E, rparen),
+	}
+
+	for n, c := range []struct {
+		rules  []GrammarRule
+		start  GrammarSym
+		tokens []Token
+		exp    []string
+		err    error
+		pos    int
+		expect []GrammarSym
+	}{
+		{
+			rules: exprRules,
+			start: E,
+			tokens: []Token{
+				newToken(num.Kind(), "1"),
+				newToken(plus.Kind(), "+"),
+				newToken(num.Kind(), "2"),
+				newToken(star.Kind(), "*"),
+				newToken(lparen.Kind(), "("),
+				newToken(num.Kind(), "3"),
+				newToken(plus.Kind(), "+"),
+				newToken(num.Kind(), "4"),
+				newToken(rparen.Kind(), ")"),
+				newToken(eof.Kind(), ""),
+			},
+			exp: []string{
+				"0(0(2(3(1))) + 2(2(3(2)) * 3(( 0(0(2(3(3))) + 2(3(4))) ))))",
+			},
+		},
+		{
+			rules: exprRules,
+			start: E,
+			tokens: []Token{
+				newToken(num.Kind(), "1"),
+				newToken(plus.Kind(), "+"),
+				newToken(rparen.Kind(), ")"),
+				newToken(eof.Kind(), ""),
+			},
+			err:    ErrParse,
+			pos:    2,
+			expect: []GrammarSym{num, lparen},
+		},
+		{
+			rules: exprRules,
+			start: E,
+			tokens: []Token{
+				newToken(num.Kind(), "1"),
+				newToken(plus.Kind(), "+"),
+				newToken(eof.Kind(), ""),
+			},
+			err:    ErrParse,
+			pos:    2,
+			expect: []GrammarSym{num, lparen},
+		},
+		{
+			rules: exprRules,
+			start: E,
+			tokens: []Token{
+				newToken(num.Kind(), "1"),
+				newToken(rparen.Kind(), ")"),
+				newToken(eof.Kind(), ""),
+			},
+			err:    ErrParse,
+			pos:    1,
+			expect: []GrammarSym{eof, plus, star},
+		},
+		{
+			rules: []GrammarRule{
+				NewGrammarRule(S, S, S),
+				NewGrammarRule(S, b),
+			},
+			start: S,
+			tokens: []Token{
+				newToken(b.Kind(), "b"),
+				newToken(b.Kind(), "b"),
+				newToken(b.Kind(), "b"),
+				newToken(eof.Kind(), ""),
+			},
+			exp: []string{
+				"9(9(9(b) 9(b)) 9(b))",
+				"9(9(b) 9(9(b) 9(b)))",
+			},
+		},
+		{
+			// hidden left recursion
+			rules: []GrammarRule{
+				NewGrammarRule(S, A, S, b),
+				NewGrammarRule(S, c),
+				NewGrammarRule(A),
+			},
+			start: S,
+			tokens: []Token{
+				newToken(c.Kind(), "c"),
+				newToken(b.Kind(), "b"),
+				newToken(b.Kind(), "b"),
+				newToken(eof.Kind(), ""),
+			},
+			exp: []string{
+				"9(10() 9(10() 9(c) b) b)",
+			},
+		},
+		{
+			// cyclic derivations are skipped
+			rules: []GrammarRule{
+				NewGrammarRule(S, S),
+				NewGrammarRule(S, c),
+			},
+			start: S,
+			tokens: []Token{
+				newToken(c.Kind(), "c"),
+				newToken(eof.Kind(), ""),
+			},
+			exp: []string{
+				"9(c)",
+			},
+		},
+		{
+			rules: []GrammarRule{
+				NewGrammarRule(S, b, S),
+				NewGrammarRule(S),
+			},
+			start: S,
+			tokens: []Token{
+				newToken(b.Kind(), "b"),
+				newToken(b.Kind(), "b"),
+			},
+			err: ErrParse,
+		},
+	} {
+		parser, err := NewEarleyParser(c.rules, c.start, eof)
+		assert.NoErrorf(err, "Failed to create parser: case %d", n)
+		if c.err != nil {
+			_, err := parser.Parse(c.tokens)
+			assert.Errorf(err, "Should fail to parse: case %d", n)
+			assert.Truef(errors.Is(err, c.err), "Should fail to parse: case %d", n)
+			var eerr *EarleyError
+			if c.expect != nil && assert.Truef(errors.As(err, &eerr), "Should report expected terminals: case %d", n) {
+				assert.Equalf(c.pos, eerr.Pos(), "Fail case %d", n)
+				assert.Equalf(c.expect, eerr.Expected(), "Fail case %d", n)
+			}
+			continue
+		}
+		assert.NoErrorf(parser.Recognize(c.tokens), "Failed to recognize: case %d", n)
+		tree, err := parser.Parse(c.tokens)
+		assert.NoErrorf(err, "Failed to parse: case %d, %v", n, err)
+		assert.Equalf(c.exp[0], parseTreeString(tree), "Fail case %d", n)
+		forest, err := parser.ParseForest(c.tokens)
+		assert.NoErrorf(err, "Failed to parse: case %d, %v", n, err)
+		strs := []string{}
+		for _, i := range forest.Trees(0) {
+			strs = append(strs, parseTreeString(i))
+			_, ok := checkParseTree(c.rules, i)
+			assert.Truef(ok, "Invalid parse tree: case %d", n)
+		}
+		assert.Equalf(c.exp, strs, "Fail case %d", n)
+	}
+}
+
+func TestEarleyParser_Leo(t *testing.T) {
+	assert := assert.New(t)
+
+	g := NewGrammarSymGenerator()
+
+	S := g.NonTerm()
+	eof := g.Term()
+	a := g.Term()
+
+	// right recursion keeps the sets of constant size
+	parser, err := NewEarleyParser([]GrammarRule{
+		NewGrammarRule(S, a, S),
+		NewGrammarRule(S, a),
+	}, S, eof)
+	assert.NoError(err, "Failed to create parser")
+
+	chartSize := func(k int) int {
+		tokens := []Token{}
+		for i := 0; i < k; i++ {
+			tokens = append(tokens, newToken(a.Kind(), "a"))
+		}
+		tokens = append(tokens, newToken(eof.Kind(), ""))
+		c, err := parser.chart(tokens)
+		assert.NoError(err, "Failed to parse")
+		size := 0
+		for _, i := range c.sets {
+			if len(i.items) > size {
+				size = len(i.items)
+			}
+		}
+		tree, err := parser.Parse(tokens)
+		assert.NoError(err, "Failed to parse")
+		_, ok := checkParseTree(parser.rules, tree)
+		assert.True(ok, "Invalid parse tree")
+		return size
+	}
+	assert.Equal(chartSize(8), chartSize(64))
+
+	// the forest only expands the Leo chains it looks up
+	const length = 20000
+	tokens := make([]Token, 0, length+1)
+	for i := 0; i < length; i++ {
+		tokens = append(tokens, newToken(a.Kind(), "a"))
+	}
+	tokens = append(tokens, newToken(eof.Kind(), ""))
+	start := time.Now()
+	tree, err := parser.Parse(tokens)
+	assert.NoError(err, "Failed to parse")
+	assert.True(time.Since(start) < 2*time.Second, "Parse should be linear in the input")
+	depth := 0
+	for node := tree; len(node.Children()) > 1; node = node.Children()[1] {
+		depth++
+	}
+	assert.Equal(length-1, depth)
+}
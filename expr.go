@@ -0,0 +1,412 @@
+package gnom
+
+import (
+	"fmt"
+)
+
+type (
+	// OpFixity is the position of an operator relative to its operands
+	OpFixity int
+
+	// OpAssoc is the associativity of an infix operator
+	OpAssoc int
+
+	Operator struct {
+		fixity OpFixity
+		term   GrammarSym
+		prec   int
+		assoc  OpAssoc
+	}
+
+	// OperatorTable defines an expression nonterminal as operands combined
+	// by prefix, infix, and postfix operators. Operators of higher precedence
+	// bind more tightly.
+	OperatorTable struct {
+		expr    GrammarSym
+		operand GrammarSym
+		ops     []Operator
+	}
+
+	// opGrammar holds the rules generated for an operator table, which match
+	// the operands and operators of an expression as a flat list:
+	//
+	//   expr -> head tail
+	//   head -> prefix head | operand
+	//   tail -> infix head tail | postfix tail | (empty)
+	//
+	// The rules are only used to check the grammar and to compute the
+	// lookahead of parsers. Expressions are parsed by an opParser.
+	opGrammar struct {
+		table *OperatorTable
+		head  GrammarSym
+		tail  GrammarSym
+		ops   map[opKey]Operator
+	}
+
+	opKey struct {
+		fixity OpFixity
+		kind   int
+	}
+
+	// opItem is an operator of an expression at the position of its token
+	opItem struct {
+		op   Operator
+		node *ParseTree
+		pos  int
+	}
+
+	// opParser parses an expression of an operator table by precedence with
+	// the shunting yard algorithm, as its operands and operators are parsed
+	// in order. Operator nodes are built as soon as the precedence of the
+	// following operator is known.
+	opParser struct {
+		g   *opGrammar
+		out []*ParseTree
+		ops []opItem
+		// pending holds an infix operator and the prefix operators after it,
+		// which are committed once the operand after them is parsed, so that
+		// a parser may end the expression before the infix operator
+		pending []opItem
+		operand bool
+		built   bool
+	}
+)
+
+const (
+	OpPrefix OpFixity = iota
+	OpInfix
+	OpPostfix
+)
+
+const (
+	OpAssocLeft OpAssoc = iota
+	OpAssocRight
+	// OpAssocNone rejects an operator being an operand of an operator of the
+	// same precedence without parentheses
+	OpAssocNone
+)
+
+func NewPrefixOperator(term GrammarSym, prec int) Operator {
+	return Operator{
+		fixity: OpPrefix,
+		term:   term,
+		prec:   prec,
+		assoc:  OpAssocRight,
+	}
+}
+
+func NewInfixOperator(term GrammarSym, prec int, assoc OpAssoc) Operator {
+	return Operator{
+		fixity: OpInfix,
+		term:   term,
+		prec:   prec,
+		assoc:  assoc,
+	}
+}
+
+func NewPostfixOperator(term GrammarSym, prec int) Operator {
+	return Operator{
+		fixity: OpPostfix,
+		term:   term,
+		prec:   prec,
+		assoc:  OpAssocLeft,
+	}
+}
+
+func (o *Operator) Fixity() OpFixity {
+	return o.fixity
+}
+
+func (o *Operator) Term() GrammarSym {
+	return o.term
+}
+
+func (o *Operator) Prec() int {
+	return o.prec
+}
+
+func (o *Operator) Assoc() OpAssoc {
+	return o.assoc
+}
+
+func (f OpFixity) String() string {
+	switch f {
+	case OpPrefix:
+		return "prefix"
+	case OpInfix:
+		return "infix"
+	case OpPostfix:
+		return "postfix"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// NewOperatorTable creates an operator table for the expression nonterminal
+// expr, which must have no production rules of its own. Operators which are
+// the operand of another are children of a node of expr with the operator
+// token, so that an infix expression is a node with the children lhs, op,
+// and rhs. An expression without operators is a node of expr with the
+// operand as its only child.
+func NewOperatorTable(expr, operand GrammarSym, ops ...Operator) *OperatorTable {
+	return &OperatorTable{
+		expr:    expr,
+		operand: operand,
+		ops:     ops,
+	}
+}
+
+func (t *OperatorTable) Expr() GrammarSym {
+	return t.expr
+}
+
+func (t *OperatorTable) Operand() GrammarSym {
+	return t.operand
+}
+
+func (t *OperatorTable) Operators() []Operator {
+	return t.ops
+}
+
+// expandOperatorTables returns the rules with the rules generated for the
+// operator tables appended, and the operator grammars by expression
+// nonterminal
+func expandOperatorTables(rules []GrammarRule, start, eof GrammarSym, tables []*OperatorTable) ([]GrammarRule, map[int]*opGrammar, error) {
+	if len(tables) == 0 {
+		return rules, nil, nil
+	}
+	syms := []GrammarSym{start, eof}
+	exprs := map[int]struct{}{}
+	for _, i := range tables {
+		if i.expr.term || i.expr.op != PEGOpNone {
+			return nil, nil, fmt.Errorf("Operator table expression is not a nonterminal: %s: %w", i.expr, ErrGrammar)
+		}
+		if _, ok := exprs[i.expr.kind]; ok {
+			return nil, nil, fmt.Errorf("Duplicate operator table: %s: %w", i.expr, ErrGrammar)
+		}
+		exprs[i.expr.kind] = struct{}{}
+		syms = append(syms, i.expr, i.operand)
+		for _, j := range i.ops {
+			syms = append(syms, j.term)
+		}
+	}
+	for n, i := range rules {
+		if _, ok := exprs[i.from]; ok {
+			return nil, nil, fmt.Errorf("Operator table expression has rules: %s: rule %d: %w", i.From(), n, ErrGrammar)
+		}
+	}
+
+	g := newGrammarSymGeneratorAfter(rules, syms...)
+	expanded := make([]GrammarRule, 0, len(rules))
+	expanded = append(expanded, rules...)
+	grammars := map[int]*opGrammar{}
+	for _, i := range tables {
+		og := &opGrammar{
+			table: i,
+			head:  g.NonTerm(),
+			tail:  g.NonTerm(),
+			ops:   map[opKey]Operator{},
+		}
+		for _, j := range i.ops {
+			if !j.term.term || j.term.op != PEGOpNone {
+				return nil, nil, fmt.Errorf("Operator is not a terminal: %s: %w", j.term, ErrGrammar)
+			}
+			if j.fixity != OpPrefix && j.fixity != OpInfix && j.fixity != OpPostfix {
+				return nil, nil, fmt.Errorf("Invalid operator fixity: %s: %w", j.term, ErrGrammar)
+			}
+			if j.assoc != OpAssocLeft && j.assoc != OpAssocRight && j.assoc != OpAssocNone {
+				return nil, nil, fmt.Errorf("Invalid operator associativity: %s: %w", j.term, ErrGrammar)
+			}
+			k := opKey{
+				fixity: j.fixity,
+				kind:   j.term.kind,
+			}
+			if _, ok := og.ops[k]; ok {
+				return nil, nil, fmt.Errorf("Duplicate %s operator: %s: %w", j.fixity, j.term, ErrGrammar)
+			}
+			og.ops[k] = j
+		}
+		expanded = append(expanded, NewGrammarRule(i.expr, og.head, og.tail))
+		for _, j := range i.ops {
+			if j.fixity == OpPrefix {
+				expanded = append(expanded, NewGrammarRule(og.head, j.term, og.head))
+			}
+		}
+		expanded = append(expanded, NewGrammarRule(og.head, i.operand))
+		for _, j := range i.ops {
+			switch j.fixity {
+			case OpInfix:
+				expanded = append(expanded, NewGrammarRule(og.tail, j.term, og.head, og.tail))
+			case OpPostfix:
+				expanded = append(expanded, NewGrammarRule(og.tail, j.term, og.tail))
+			}
+		}
+		expanded = append(expanded, NewGrammarRule(og.tail))
+		grammars[i.expr.kind] = og
+	}
+	return expanded, grammars, nil
+}
+
+// op returns the operator of the fixity of the terminal kind
+func (g *opGrammar) op(fixity OpFixity, kind int) (Operator, bool) {
+	o, ok := g.ops[opKey{
+		fixity: fixity,
+		kind:   kind,
+	}]
+	return o, ok
+}
+
+// terms returns the terminals of the operators of the fixities
+func (g *opGrammar) terms(fixities ...OpFixity) []GrammarSym {
+	terms := []GrammarSym{}
+	for _, i := range g.table.ops {
+		for _, j := range fixities {
+			if i.fixity == j {
+				terms = append(terms, i.term)
+				break
+			}
+		}
+	}
+	return terms
+}
+
+func newOpParser(g *opGrammar) *opParser {
+	return &opParser{
+		g:       g,
+		out:     []*ParseTree{},
+		ops:     []opItem{},
+		pending: []opItem{},
+		operand: true,
+		built:   false,
+	}
+}
+
+// ExpectOperand returns true if an operand or a prefix operator is expected
+// next
+func (o *opParser) ExpectOperand() bool {
+	return o.operand
+}
+
+// Empty returns true if no operand has been parsed
+func (o *opParser) Empty() bool {
+	return len(o.out) == 0
+}
+
+func (o *opParser) Prefix(op Operator, node *ParseTree, pos int) {
+	o.pending = append(o.pending, opItem{
+		op:   op,
+		node: node,
+		pos:  pos,
+	})
+}
+
+func (o *opParser) Infix(op Operator, node *ParseTree, pos int) {
+	o.pending = append(o.pending, opItem{
+		op:   op,
+		node: node,
+		pos:  pos,
+	})
+	o.operand = true
+}
+
+// Operand commits the pending operators and adds the operand. An operator
+// which chains a non associative operator is an error, and is otherwise
+// treated as left associative, so that a parser may continue.
+func (o *opParser) Operand(node *ParseTree) error {
+	var err error
+	for _, i := range o.pending {
+		if i.op.fixity == OpInfix {
+			if e := o.reduce(i); e != nil && err == nil {
+				err = e
+			}
+		}
+		o.ops = append(o.ops, i)
+	}
+	o.pending = o.pending[:0]
+	o.out = append(o.out, node)
+	o.operand = false
+	return err
+}
+
+func (o *opParser) Postfix(op Operator, node *ParseTree) {
+	for len(o.ops) > 0 && o.ops[len(o.ops)-1].op.prec >= op.prec {
+		o.apply(o.ops[len(o.ops)-1])
+		o.ops = o.ops[:len(o.ops)-1]
+	}
+	n := newParseTree(o.g.table.expr)
+	n.children = []*ParseTree{o.out[len(o.out)-1], node}
+	o.out[len(o.out)-1] = n
+	o.built = true
+}
+
+// Backoff discards the pending operators, ending the expression before them,
+// and returns the pending infix operator, if any
+func (o *opParser) Backoff() (opItem, bool) {
+	var infix opItem
+	ok := len(o.pending) > 0 && o.pending[0].op.fixity == OpInfix
+	if ok {
+		infix = o.pending[0]
+	}
+	o.pending = o.pending[:0]
+	o.operand = false
+	return infix, ok
+}
+
+// reduce builds the nodes of the operators which bind more tightly than the
+// infix operator. Chaining a non associative operator is a *ParseError at the
+// token of the infix operator, which expects no particular terminal.
+func (o *opParser) reduce(i opItem) error {
+	var err error
+	for len(o.ops) > 0 {
+		top := o.ops[len(o.ops)-1]
+		if top.op.prec == i.op.prec && top.op.fixity == OpInfix && (top.op.assoc == OpAssocNone || i.op.assoc == OpAssocNone) {
+			if err == nil {
+				expr := o.g.table.expr
+				err = &ParseError{
+					pos:      i.pos,
+					token:    i.node.token,
+					nonTerm:  &expr,
+					expected: []GrammarSym{},
+				}
+			}
+		} else if !(top.op.prec > i.op.prec || (top.op.prec == i.op.prec && (top.op.fixity == OpPrefix || i.op.assoc == OpAssocLeft))) {
+			break
+		}
+		o.apply(top)
+		o.ops = o.ops[:len(o.ops)-1]
+	}
+	return err
+}
+
+func (o *opParser) apply(i opItem) {
+	n := newParseTree(o.g.table.expr)
+	if i.op.fixity == OpPrefix {
+		n.children = []*ParseTree{i.node, o.out[len(o.out)-1]}
+		o.out[len(o.out)-1] = n
+	} else {
+		lhs, rhs := o.out[len(o.out)-2], o.out[len(o.out)-1]
+		n.children = []*ParseTree{lhs, i.node, rhs}
+		o.out = o.out[:len(o.out)-1]
+		o.out[len(o.out)-1] = n
+	}
+	o.built = true
+}
+
+// Tree builds the remaining operator nodes and returns the node of the
+// expression. An expression without operators is a node with the operand as
+// its only child.
+func (o *opParser) Tree() *ParseTree {
+	for len(o.ops) > 0 {
+		o.apply(o.ops[len(o.ops)-1])
+		o.ops = o.ops[:len(o.ops)-1]
+	}
+	if len(o.out) == 0 {
+		return newParseTree(o.g.table.expr)
+	}
+	if !o.built {
+		n := newParseTree(o.g.table.expr)
+		n.children = []*ParseTree{o.out[0]}
+		return n
+	}
+	return o.out[0]
+}
@@ -0,0 +1,197 @@
+package gnom
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestOperatorTable(t *testing.T) {
+	assert := assert.New(t)
+
+	g := NewGrammarSymGenerator()
+
+	S := g.NonTerm()
+	eof := g.Term()
+
+	E := g.NonTerm()
+	Atom := g.NonTerm()
+	num := g.Term()
+	plus := g.Term()
+	minus := g.Term()
+	star := g.Term()
+	caret := g.Term()
+	bang := g.Term()
+	eq := g.Term()
+	lparen := g.Term()
+	rparen := g.Term()
+
+	terms := map[string]GrammarSym{
+		"+": plus,
+		"-": minus,
+		"*": star,
+		"^": caret,
+		"!": bang,
+		"=": eq,
+		"(": lparen,
+		")": rparen,
+	}
+	lex := func(s string) []Token {
+		tokens := []Token{}
+		for _, i := range strings.Fields(s) {
+			if k, ok := terms[i]; ok {
+				tokens = append(tokens, newToken(k.Kind(), i))
+			} else {
+				tokens = append(tokens, newToken(num.Kind(), i))
+			}
+		}
+		return append(tokens, newToken(eof.Kind(), ""))
+	}
+
+	rules := []GrammarRule{
+		NewGrammarRule(S, E),
+		NewGrammarRule(Atom, num),
+		NewGrammarRule(Atom, lparen, E, rparen),
+	}
+	table := NewOperatorTable(E, Atom,
+		NewInfixOperator(eq, 0, OpAssocNone),
+		NewInfixOperator(plus, 1, OpAssocLeft),
+		NewInfixOperator(minus, 1, OpAssocLeft),
+		NewInfixOperator(star, 2, OpAssocLeft),
+		NewInfixOperator(caret, 3, OpAssocRight),
+		NewPrefixOperator(minus, 4),
+		NewPostfixOperator(bang, 5),
+	)
+
+	ll1, err := NewLL1Parser(rules, S, eof, LL1ParserOperators(table))
+	assert.NoError(err, "Failed to create parser")
+	peg, err := NewPEGParser(rules, S, eof, PEGParserOperators(table))
+	assert.NoError(err, "Failed to create parser")
+	pegStrict, err := NewPEGParser(rules, S, eof, PEGParserOperators(table), PEGParserMode(PEGModeStrict))
+	assert.NoError(err, "Failed to create parser")
+
+	for n, c := range []struct {
+		input string
+		exp   string
+		// nonAssoc is true if the error is of a non associative operator
+		nonAssoc bool
+	}{
+		{
+			input: "1",
+			exp:   "0(2(3(1)))",
+		},
+		{
+			input: "1 + 2 * 3",
+			exp:   "0(2(3(1) + 2(3(2) * 3(3))))",
+		},
+		{
+			input: "1 - 2 - 3",
+			exp:   "0(2(2(3(1) - 3(2)) - 3(3)))",
+		},
+		{
+			input: "1 ^ 2 ^ 3",
+			exp:   "0(2(3(1) ^ 2(3(2) ^ 3(3))))",
+		},
+		{
+			input: "- 1 ^ 2",
+			exp:   "0(2(2(- 3(1)) ^ 3(2)))",
+		},
+		{
+			input: "2 * - 1 ^ 2",
+			exp:   "0(2(3(2) * 2(2(- 3(1)) ^ 3(2))))",
+		},
+		{
+			input: "- 1 !",
+			exp:   "0(2(- 2(3(1) !)))",
+		},
+		{
+			input: "1 + 2 ! * 3",
+			exp:   "0(2(3(1) + 2(2(3(2) !) * 3(3))))",
+		},
+		{
+			input: "( 1 + 2 ) * 3",
+			exp:   "0(2(3(( 2(3(1) + 3(2)) )) * 3(3)))",
+		},
+		{
+			input: "1 = 2 + 3",
+			exp:   "0(2(3(1) = 2(3(2) + 3(3))))",
+		},
+		{
+			input:    "1 = 2 = 3",
+			nonAssoc: true,
+		},
+		{
+			input:    "1 = 2 = 3 +",
+			nonAssoc: true,
+		},
+		{
+			input: "1 + * 3",
+		},
+	} {
+		for _, p := range []struct {
+			name   string
+			parser interface {
+				Parse(tokens []Token) (*ParseTree, error)
+			}
+		}{
+			{
+				name:   "LL(1)",
+				parser: ll1,
+			},
+			{
+				name:   "PEG",
+				parser: peg,
+			},
+			{
+				name:   "PEG strict",
+				parser: pegStrict,
+			},
+		} {
+			tree, err := p.parser.Parse(lex(c.input))
+			if c.exp == "" {
+				assert.Errorf(err, "Should fail to parse: %s case %d", p.name, n)
+				assert.Truef(errors.Is(err, ErrParse), "Should fail to parse: %s case %d", p.name, n)
+				var perr *ParseError
+				if c.nonAssoc && assert.Truef(errors.As(err, &perr), "Should be a *ParseError: %s case %d", p.name, n) {
+					assert.Equalf(3, perr.Pos(), "Should fail at the operator: %s case %d", p.name, n)
+					token := perr.Token()
+					assert.Equalf("=", token.Val(), "Should fail at the operator: %s case %d", p.name, n)
+					nonTerm, ok := perr.NonTerm()
+					assert.Truef(ok, "Should report the expression: %s case %d", p.name, n)
+					assert.Equalf(E, nonTerm, "Should report the expression: %s case %d", p.name, n)
+					assert.Equalf([]GrammarSym{}, perr.Expected(), "Should expect no terminals: %s case %d", p.name, n)
+				}
+				continue
+			}
+			assert.NoErrorf(err, "Failed to parse: %s case %d, %v", p.name, n, err)
+			assert.Equalf(c.exp, parseTreeString(tree), "Fail %s case %d", p.name, n)
+		}
+	}
+
+	{
+		tree, errs := ll1.ParseRecover(lex("( 1 + ) * 3 = 4 = 5"))
+		assert.Len(errs, 2, "Should report every error")
+		var perr *ParseError
+		if assert.True(errors.As(errs[0], &perr), "Should be a *ParseError") {
+			assert.Equal(3, perr.Pos(), "Should fail at the missing operand")
+		}
+		if assert.True(errors.As(errs[1], &perr), "Should be a *ParseError") {
+			assert.Equal(8, perr.Pos(), "Should fail at the operator")
+		}
+		assert.Equal("0(2(2(2(3(( 2(3(1) + 3()) )) * 3(3)) = 3(4)) = 3(5)))", parseTreeString(tree), "Should build operator nodes around the missing operand")
+	}
+
+	_, err = NewLL1Parser(append([]GrammarRule{NewGrammarRule(E, num)}, rules...), S, eof, LL1ParserOperators(table))
+	assert.True(errors.Is(err, ErrGrammar), "Expression with rules should fail")
+	_, err = NewPEGParser(rules, S, eof, PEGParserOperators(NewOperatorTable(E, Atom,
+		NewInfixOperator(plus, 1, OpAssocLeft),
+		NewInfixOperator(plus, 2, OpAssocLeft),
+	)))
+	assert.True(errors.Is(err, ErrGrammar), "Duplicate operator should fail")
+	_, err = NewLL1Parser(rules, S, eof, LL1ParserOperators(NewOperatorTable(E, Atom,
+		NewInfixOperator(bang, 1, OpAssocLeft),
+		NewPostfixOperator(bang, 2),
+	)))
+	assert.True(errors.Is(err, ErrGrammar), "Operator both infix and postfix is not LL(1)")
+}
@@ -0,0 +1,199 @@
+package gnom
+
+import (
+	"math/rand"
+	"strings"
+)
+
+type (
+	SentenceGenerator struct {
+		ruleMap  map[int][][]GrammarSym
+		heights  map[int][]int
+		start    GrammarSym
+		eof      GrammarSym
+		rand     *rand.Rand
+		maxDepth int
+		maxSize  int
+		sample   func(kind int, r *rand.Rand) string
+	}
+
+	SentenceGeneratorOpt func(g *SentenceGenerator)
+
+	genFrame struct {
+		sym   GrammarSym
+		depth int
+	}
+)
+
+// SentenceGeneratorMaxDepth sets the derivation depth after which only the
+// shortest terminating rules are chosen
+func SentenceGeneratorMaxDepth(depth int) SentenceGeneratorOpt {
+	return func(g *SentenceGenerator) {
+		g.maxDepth = depth
+	}
+}
+
+// SentenceGeneratorMaxSize sets the number of symbols after which only the
+// shortest terminating rules are chosen
+func SentenceGeneratorMaxSize(size int) SentenceGeneratorOpt {
+	return func(g *SentenceGenerator) {
+		g.maxSize = size
+	}
+}
+
+// SentenceGeneratorSample sets the function producing the value of a token of
+// a terminal kind
+func SentenceGeneratorSample(sample func(kind int, r *rand.Rand) string) SentenceGeneratorOpt {
+	return func(g *SentenceGenerator) {
+		g.sample = sample
+	}
+}
+
+func maxInt(a, b int) int {
+	if b > a {
+		return b
+	}
+	return a
+}
+
+// calcRuleHeights returns for each nonterminal the height of the shortest
+// derivation tree of each of its rules, or -1 if the rule does not terminate
+func calcRuleHeights(ruleMap map[int][][]GrammarSym) map[int][]int {
+	heights := map[int][]int{}
+	minHeights := map[int]int{}
+	for k, v := range ruleMap {
+		h := make([]int, len(v))
+		for n := range h {
+			h[n] = -1
+		}
+		heights[k] = h
+	}
+	for {
+		changed := false
+		for k, v := range ruleMap {
+			for n, i := range v {
+				h := 1
+				for _, j := range i {
+					if j.term {
+						continue
+					}
+					m, ok := minHeights[j.kind]
+					if !ok {
+						h = -1
+						break
+					}
+					h = maxInt(h, m+1)
+				}
+				if h < 0 {
+					continue
+				}
+				if prev := heights[k][n]; prev < 0 || h < prev {
+					heights[k][n] = h
+					changed = true
+				}
+				if m, ok := minHeights[k]; !ok || h < m {
+					minHeights[k] = h
+				}
+			}
+		}
+		if !changed {
+			return heights
+		}
+	}
+}
+
+// NewSentenceGenerator creates a generator of random sentences of a grammar
+// seeded by seed
+func NewSentenceGenerator(rules []GrammarRule, start, eof GrammarSym, seed int64, opts ...SentenceGeneratorOpt) (*SentenceGenerator, error) {
+	if err := checkGrammarErr(CheckGrammar(rules, start, eof)); err != nil {
+		return nil, err
+	}
+	ruleMap := map[int][][]GrammarSym{}
+	for _, i := range rules {
+		ruleMap[i.from] = append(ruleMap[i.from], i.to)
+	}
+	g := &SentenceGenerator{
+		ruleMap:  ruleMap,
+		heights:  calcRuleHeights(ruleMap),
+		start:    start,
+		eof:      eof,
+		rand:     rand.New(rand.NewSource(seed)),
+		maxDepth: 16,
+		maxSize:  64,
+	}
+	for _, i := range opts {
+		i(g)
+	}
+	return g, nil
+}
+
+func NewSentenceGeneratorFromGrammar(g *Grammar, seed int64, opts ...SentenceGeneratorOpt) (*SentenceGenerator, error) {
+	return NewSentenceGenerator(g.rules, g.start, g.eof, seed, opts...)
+}
+
+func (g *SentenceGenerator) chooseRule(kind int, exhausted bool) []GrammarSym {
+	alts := g.ruleMap[kind]
+	heights := g.heights[kind]
+	candidates := make([]int, 0, len(alts))
+	if exhausted {
+		lowest := -1
+		for _, h := range heights {
+			if h >= 0 && (lowest < 0 || h < lowest) {
+				lowest = h
+			}
+		}
+		for n, h := range heights {
+			if h == lowest {
+				candidates = append(candidates, n)
+			}
+		}
+	} else {
+		for n, h := range heights {
+			if h >= 0 {
+				candidates = append(candidates, n)
+			}
+		}
+	}
+	return alts[candidates[g.rand.Intn(len(candidates))]]
+}
+
+// Generate returns the tokens of a random sentence of the grammar terminated
+// by an eof token. Once the derivation exceeds the maximum depth or size,
+// only the rules with the shortest derivations are chosen.
+func (g *SentenceGenerator) Generate() []Token {
+	tokens := []Token{}
+	stack := []genFrame{{sym: g.start, depth: 0}}
+	for len(stack) > 0 {
+		f := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if f.sym.term {
+			val := ""
+			if g.sample != nil {
+				val = g.sample(f.sym.kind, g.rand)
+			}
+			tokens = append(tokens, newToken(f.sym.kind, val))
+			continue
+		}
+		exhausted := f.depth >= g.maxDepth || len(tokens)+len(stack) >= g.maxSize
+		to := g.chooseRule(f.sym.kind, exhausted)
+		for i := len(to) - 1; i >= 0; i-- {
+			stack = append(stack, genFrame{
+				sym:   to[i],
+				depth: f.depth + 1,
+			})
+		}
+	}
+	return append(tokens, newToken(g.eof.kind, ""))
+}
+
+// RenderTokens joins the values of tokens with a separator
+func RenderTokens(tokens []Token, sep string) string {
+	vals := make([]string, 0, len(tokens))
+	for _, i := range tokens {
+		if i.Val() == "" {
+			continue
+		}
+		vals = append(vals, i.Val())
+	}
+	return strings.Join(vals, sep)
+}
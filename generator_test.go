@@ -0,0 +1,102 @@
+package gnom
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+func TestSentenceGenerator(t *testing.T) {
+	assert := assert.New(t)
+
+	g := NewGrammarSymGenerator()
+
+	def := g.Term()
+	eof := g.Term()
+	wspace := g.Term()
+	S := g.NonTerm()
+
+	T := g.NonTerm()
+	SP := g.NonTerm()
+	TP := g.NonTerm()
+	F := g.NonTerm()
+	num := g.Term()
+	plus := g.Term()
+	star := g.Term()
+	lparen := g.Term()
+	rparen := g.Term()
+
+	dfa := NewDfa(def.Kind())
+	wspaceNode := NewDfa(wspace.Kind())
+	dfa.AddDfa([]rune(" "), wspaceNode)
+	wspaceNode.AddDfa([]rune(" "), wspaceNode)
+	numNode := NewDfa(num.Kind())
+	dfa.AddDfa([]rune("0123456789"), numNode)
+	numNode.AddDfa([]rune("0123456789"), numNode)
+	dfa.AddPath([]rune("+"), plus.Kind(), def.Kind())
+	dfa.AddPath([]rune("*"), star.Kind(), def.Kind())
+	dfa.AddPath([]rune("("), lparen.Kind(), def.Kind())
+	dfa.AddPath([]rune(")"), rparen.Kind(), def.Kind())
+	lexer := NewDfaLexer(dfa, def.Kind(), eof.Kind(), map[int]struct{}{
+		wspace.Kind(): {},
+	})
+
+	rules := []GrammarRule{
+		NewGrammarRule(S, T, SP),
+		NewGrammarRule(SP, plus, T, SP),
+		NewGrammarRule(SP),
+		NewGrammarRule(T, F, TP),
+		NewGrammarRule(TP, star, F, TP),
+		NewGrammarRule(TP),
+		NewGrammarRule(F, num),
+		NewGrammarRule(F, lparen, S, rparen),
+	}
+	parser, err := NewLL1Parser(rules, S, eof)
+	assert.NoErrorf(err, "Failed to create parser: %v", err)
+
+	sample := func(kind int, r *rand.Rand) string {
+		switch kind {
+		case num.Kind():
+			return strconv.Itoa(r.Intn(100))
+		case plus.Kind():
+			return "+"
+		case star.Kind():
+			return "*"
+		case lparen.Kind():
+			return "("
+		case rparen.Kind():
+			return ")"
+		default:
+			return ""
+		}
+	}
+
+	gen, err := NewSentenceGenerator(rules, S, eof, 8, SentenceGeneratorMaxDepth(12), SentenceGeneratorMaxSize(32), SentenceGeneratorSample(sample))
+	assert.NoErrorf(err, "Failed to create generator: %v", err)
+	gen2, err := NewSentenceGenerator(rules, S, eof, 8, SentenceGeneratorMaxDepth(12), SentenceGeneratorMaxSize(32), SentenceGeneratorSample(sample))
+	assert.NoErrorf(err, "Failed to create generator: %v", err)
+
+	lengths := map[int]struct{}{}
+	for i := 0; i < 64; i++ {
+		tokens := gen.Generate()
+		assert.Equal(tokens, gen2.Generate(), "Generators with the same seed should agree")
+		assert.Equal(eof.Kind(), tokens[len(tokens)-1].Kind(), "Sentence should end with eof")
+		lengths[len(tokens)] = struct{}{}
+		_, err := parser.Parse(tokens)
+		assert.NoErrorf(err, "Generated sentence should parse: %v", err)
+
+		text := RenderTokens(tokens, " ")
+		lexed, err := lexer.Tokenize([]rune(text))
+		assert.NoErrorf(err, "Failed to tokenize %s: %v", text, err)
+		assert.Equalf(tokens, lexed, "Rendered sentence should lex to its tokens: %s", text)
+	}
+	assert.Greater(len(lengths), 4, "Generated sentences should vary")
+
+	small, err := NewSentenceGenerator(rules, S, eof, 1, SentenceGeneratorMaxDepth(0))
+	assert.NoErrorf(err, "Failed to create generator: %v", err)
+	assert.Equal([]Token{
+		newToken(num.Kind(), ""),
+		newToken(eof.Kind(), ""),
+	}, small.Generate(), "Exhausted generator should choose shortest derivations")
+}
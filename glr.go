@@ -0,0 +1,456 @@
+package gnom
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type (
+	// SPPFNode is a node of a shared packed parse forest, deriving the tokens
+	// from start up to end. A nonterminal node has an alternative for each
+	// distinct way it derives those tokens.
+	SPPFNode struct {
+		id    int
+		sym   GrammarSym
+		token Token
+		start int
+		end   int
+		alts  []*SPPFAlternative
+		keys  map[string]struct{}
+	}
+
+	SPPFAlternative struct {
+		rule     int
+		children []*SPPFNode
+	}
+
+	// SPPFFilter returns the alternatives to keep of an ambiguous node
+	SPPFFilter func(node *SPPFNode, alts []*SPPFAlternative) []*SPPFAlternative
+
+	ParseForest struct {
+		root  *SPPFNode
+		rules []GrammarRule
+	}
+
+	GLRParser struct {
+		table   *lrTable
+		start   GrammarSym
+		eof     GrammarSym
+		filters []SPPFFilter
+		prec    *LRPrecedence
+	}
+
+	GLRParserOpt func(p *GLRParser)
+
+	gssNode struct {
+		state int
+		level int
+		edges []gssEdge
+	}
+
+	gssEdge struct {
+		to   *gssNode
+		sppf *SPPFNode
+	}
+
+	sppfKey struct {
+		kind  int
+		start int
+		end   int
+	}
+
+	glrLevel struct {
+		nodes []*gssNode
+		index map[int]*gssNode
+	}
+)
+
+func (n *SPPFNode) Term() bool {
+	return n.sym.term
+}
+
+func (n *SPPFNode) Kind() int {
+	return n.sym.kind
+}
+
+func (n *SPPFNode) Sym() GrammarSym {
+	return n.sym
+}
+
+func (n *SPPFNode) Val() string {
+	return n.token.val
+}
+
+func (n *SPPFNode) Token() Token {
+	return n.token
+}
+
+// Start returns the index of the first token derived by the node
+func (n *SPPFNode) Start() int {
+	return n.start
+}
+
+// End returns the index one past the last token derived by the node
+func (n *SPPFNode) End() int {
+	return n.end
+}
+
+func (n *SPPFNode) Alternatives() []*SPPFAlternative {
+	return n.alts
+}
+
+// Ambiguous returns true if the node has more than one alternative
+func (n *SPPFNode) Ambiguous() bool {
+	return len(n.alts) > 1
+}
+
+func (n *SPPFNode) addAlternative(rule int, children []*SPPFNode) bool {
+	k := strings.Builder{}
+	k.WriteString(strconv.Itoa(rule))
+	for _, i := range children {
+		k.WriteByte(',')
+		k.WriteString(strconv.Itoa(i.id))
+	}
+	key := k.String()
+	if _, ok := n.keys[key]; ok {
+		return false
+	}
+	n.keys[key] = struct{}{}
+	n.alts = append(n.alts, &SPPFAlternative{
+		rule:     rule,
+		children: children,
+	})
+	return true
+}
+
+// Rule returns the index of the rule of the alternative
+func (a *SPPFAlternative) Rule() int {
+	return a.rule
+}
+
+func (a *SPPFAlternative) Children() []*SPPFNode {
+	return a.children
+}
+
+func (f *ParseForest) Root() *SPPFNode {
+	return f.root
+}
+
+func (f *ParseForest) Rules() []GrammarRule {
+	return f.rules
+}
+
+func (f *ParseForest) walk(fn func(n *SPPFNode)) {
+	seen := map[*SPPFNode]struct{}{
+		f.root: {},
+	}
+	stack := []*SPPFNode{f.root}
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		fn(n)
+		for _, i := range n.alts {
+			for _, j := range i.children {
+				if _, ok := seen[j]; ok {
+					continue
+				}
+				seen[j] = struct{}{}
+				stack = append(stack, j)
+			}
+		}
+	}
+}
+
+// Ambiguous returns true if any node reachable from the root is ambiguous
+func (f *ParseForest) Ambiguous() bool {
+	ambiguous := false
+	f.walk(func(n *SPPFNode) {
+		if n.Ambiguous() {
+			ambiguous = true
+		}
+	})
+	return ambiguous
+}
+
+// Disambiguate applies the filters in order to every ambiguous node of the
+// forest, removing the alternatives they reject
+func (f *ParseForest) Disambiguate(filters ...SPPFFilter) {
+	f.walk(func(n *SPPFNode) {
+		for _, i := range filters {
+			if !n.Ambiguous() {
+				return
+			}
+			n.alts = i(n, n.alts)
+		}
+	})
+}
+
+// Trees returns the parse trees of the forest, up to limit if limit is
+// positive. Derivations which contain a node within itself are skipped.
+func (f *ParseForest) Trees(limit int) []*ParseTree {
+	return sppfTrees(f.root, map[*SPPFNode]struct{}{}, limit)
+}
+
+func sppfTrees(n *SPPFNode, path map[*SPPFNode]struct{}, limit int) []*ParseTree {
+	if n.Term() {
+		return []*ParseTree{newParseTreeLeaf(n.sym, n.token)}
+	}
+	if _, ok := path[n]; ok {
+		return nil
+	}
+	path[n] = struct{}{}
+	defer delete(path, n)
+	trees := []*ParseTree{}
+	for _, i := range n.alts {
+		// partial holds the children lists of the trees built so far
+		partial := [][]*ParseTree{{}}
+		for _, j := range i.children {
+			subtrees := sppfTrees(j, path, limit)
+			next := [][]*ParseTree{}
+			for _, k := range partial {
+				for _, l := range subtrees {
+					if limit > 0 && len(next) >= limit {
+						break
+					}
+					children := make([]*ParseTree, 0, len(k)+1)
+					children = append(children, k...)
+					children = append(children, l)
+					next = append(next, children)
+				}
+			}
+			partial = next
+		}
+		for _, j := range partial {
+			if limit > 0 && len(trees) >= limit {
+				return trees
+			}
+			t := newParseTree(n.sym)
+			for _, k := range j {
+				t.addChild(k)
+			}
+			trees = append(trees, t)
+		}
+	}
+	return trees
+}
+
+// GLRParserFilter adds a filter used to disambiguate parse forests
+func GLRParserFilter(filter SPPFFilter) GLRParserOpt {
+	return func(p *GLRParser) {
+		p.filters = append(p.filters, filter)
+	}
+}
+
+// GLRParserPrecedence sets the precedence declarations used to resolve
+// shift reduce conflicts before parsing
+func GLRParserPrecedence(prec *LRPrecedence) GLRParserOpt {
+	return func(p *GLRParser) {
+		p.prec = prec
+	}
+}
+
+// NewGLRParser creates a generalized LR parser, which follows every action
+// of an LALR(1) table with conflicts, and so accepts any grammar
+func NewGLRParser(rules []GrammarRule, start, eof GrammarSym, opts ...GLRParserOpt) (*GLRParser, error) {
+	if err := checkGrammarErr(CheckGrammar(rules, start, eof)); err != nil {
+		return nil, err
+	}
+	p := &GLRParser{
+		start:   start,
+		eof:     eof,
+		filters: []SPPFFilter{},
+		prec:    nil,
+	}
+	for _, i := range opts {
+		i(p)
+	}
+	b := newLRBuilder(rules, start, eof)
+	b.prec = p.prec
+	states := b.states(false)
+	b.calcLALRLookaheads(states)
+	p.table = b.table(states, nil)
+	return p, nil
+}
+
+// Conflicts returns the conflicts of the parse table which remain after
+// resolution by precedence
+func (p *GLRParser) Conflicts() []LRConflict {
+	return p.table.conflicts
+}
+
+// Resolved returns the conflicts of the parse table which were resolved by
+// precedence
+func (p *GLRParser) Resolved() []LRConflict {
+	return p.table.resolved
+}
+
+func NewGLRParserFromGrammar(g *Grammar, opts ...GLRParserOpt) (*GLRParser, error) {
+	return NewGLRParser(g.rules, g.start, g.eof, opts...)
+}
+
+func newGLRLevel() *glrLevel {
+	return &glrLevel{
+		nodes: []*gssNode{},
+		index: map[int]*gssNode{},
+	}
+}
+
+func (l *glrLevel) node(state, level int) (*gssNode, bool) {
+	if n, ok := l.index[state]; ok {
+		return n, false
+	}
+	n := &gssNode{
+		state: state,
+		level: level,
+		edges: []gssEdge{},
+	}
+	l.nodes = append(l.nodes, n)
+	l.index[state] = n
+	return n, true
+}
+
+func (n *gssNode) addEdge(to *gssNode, sppf *SPPFNode) bool {
+	for _, i := range n.edges {
+		if i.to == to {
+			return false
+		}
+	}
+	n.edges = append(n.edges, gssEdge{
+		to:   to,
+		sppf: sppf,
+	})
+	return true
+}
+
+// gssPaths calls fn with the node reached and the forest nodes passed by
+// every path of length k from n
+func gssPaths(n *gssNode, k int, children []*SPPFNode, fn func(to *gssNode, children []*SPPFNode)) {
+	if k == 0 {
+		c := make([]*SPPFNode, len(children))
+		copy(c, children)
+		fn(n, c)
+		return
+	}
+	for _, i := range n.edges {
+		children[k-1] = i.sppf
+		gssPaths(i.to, k-1, children, fn)
+	}
+}
+
+// ParseForest parses the tokens and returns every derivation of them from
+// the start symbol
+func (p *GLRParser) ParseForest(tokens []Token) (*ParseForest, error) {
+	nodes := map[sppfKey]*SPPFNode{}
+	count := 0
+	sppfNode := func(sym GrammarSym, start, end int) *SPPFNode {
+		k := sppfKey{
+			kind:  sym.kind,
+			start: start,
+			end:   end,
+		}
+		if n, ok := nodes[k]; ok {
+			return n
+		}
+		n := &SPPFNode{
+			id:    count,
+			sym:   sym,
+			start: start,
+			end:   end,
+			alts:  []*SPPFAlternative{},
+			keys:  map[string]struct{}{},
+		}
+		count++
+		nodes[k] = n
+		return n
+	}
+
+	level := newGLRLevel()
+	level.node(0, 0)
+	for pos, token := range tokens {
+		// reduce until no new stack nodes or edges are added, as a new edge
+		// may create new reduction paths through existing nodes
+		for changed := true; changed; {
+			changed = false
+			for n := 0; n < len(level.nodes); n++ {
+				v := level.nodes[n]
+				for _, a := range p.table.actions[v.state][token.Kind()] {
+					if a.kind != LRActionReduce {
+						continue
+					}
+					r := p.table.rules[a.target]
+					gssPaths(v, len(r.to), make([]*SPPFNode, len(r.to)), func(u *gssNode, children []*SPPFNode) {
+						sppf := sppfNode(r.From(), u.level, pos)
+						sppf.addAlternative(a.target, children)
+						w, created := level.node(p.table.gotos[u.state][r.from], pos)
+						if w.addEdge(u, sppf) || created {
+							changed = true
+						}
+					})
+				}
+			}
+		}
+
+		next := newGLRLevel()
+		var leaf *SPPFNode
+		for _, v := range level.nodes {
+			for _, a := range p.table.actions[v.state][token.Kind()] {
+				switch a.kind {
+				case LRActionAccept:
+					if root, ok := nodes[sppfKey{
+						kind:  p.start.kind,
+						start: 0,
+						end:   pos,
+					}]; ok {
+						return &ParseForest{
+							root:  root,
+							rules: p.table.rules[:len(p.table.rules)-1],
+						}, nil
+					}
+				case LRActionShift:
+					if leaf == nil {
+						leaf = &SPPFNode{
+							id:    count,
+							sym:   NewGrammarTerm(token.Kind()),
+							token: token,
+							start: pos,
+							end:   pos + 1,
+							alts:  []*SPPFAlternative{},
+							keys:  map[string]struct{}{},
+						}
+						count++
+					}
+					w, _ := next.node(a.target, pos+1)
+					w.addEdge(v, leaf)
+				}
+			}
+		}
+		if len(next.nodes) == 0 {
+			states := make([]int, 0, len(level.nodes))
+			for _, v := range level.nodes {
+				states = append(states, v.state)
+			}
+			return nil, p.table.parseError(states, pos, token)
+		}
+		level = next
+	}
+	return nil, fmt.Errorf("Unexpected end of token stream: %w", ErrParse)
+}
+
+// Parse returns the only parse tree of the tokens remaining after
+// disambiguation by the filters of the parser
+func (p *GLRParser) Parse(tokens []Token) (*ParseTree, error) {
+	forest, err := p.ParseForest(tokens)
+	if err != nil {
+		return nil, err
+	}
+	forest.Disambiguate(p.filters...)
+	trees := forest.Trees(2)
+	if len(trees) == 0 {
+		return nil, fmt.Errorf("No parse tree remains after disambiguation: %w", ErrParse)
+	}
+	if len(trees) > 1 {
+		return nil, fmt.Errorf("Ambiguous parse: %w", ErrParse)
+	}
+	return trees[0], nil
+}
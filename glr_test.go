@@ -0,0 +1,170 @@
+package gnom
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"sort"
+	"testing"
+)
+
+func TestGLRParser_Parse(t *testing.T) {
+	assert := assert.New(t)
+
+	g := NewGrammarSymGenerator()
+
+	E := g.NonTerm()
+	eof := g.Term()
+
+	num := g.Term()
+	plus := g.Term()
+	S := g.NonTerm()
+	A := g.NonTerm()
+	b := g.Term()
+	c := g.Term()
+
+	exprRules := []GrammarRule{
+		NewGrammarRule(E, E, plus, E),
+		NewGrammarRule(E, num),
+	}
+	_, err := NewLRParser(exprRules, E, eof, LRModeCanonical)
+	assert.Error(err, "Ambiguous grammar should not be LR(1)")
+
+	// leftAssoc keeps the alternatives with the longest left operand
+	leftAssoc := func(node *SPPFNode, alts []*SPPFAlternative) []*SPPFAlternative {
+		end := 0
+		for _, i := range alts {
+			if k := i.Children()[0].End(); k > end {
+				end = k
+			}
+		}
+		kept := []*SPPFAlternative{}
+		for _, i := range alts {
+			if i.Children()[0].End() == end {
+				kept = append(kept, i)
+			}
+		}
+		return kept
+	}
+
+	parser, err := NewGLRParser(exprRules, E, eof)
+	assert.NoError(err, "Failed to create parser")
+	tokens := []Token{
+		newToken(num.Kind(), "1"),
+		newToken(plus.Kind(), "+"),
+		newToken(num.Kind(), "2"),
+		newToken(plus.Kind(), "+"),
+		newToken(num.Kind(), "3"),
+		newToken(plus.Kind(), "+"),
+		newToken(num.Kind(), "4"),
+		newToken(eof.Kind(), ""),
+	}
+	{
+		forest, err := parser.ParseForest(tokens)
+		assert.NoError(err, "Failed to parse")
+		assert.True(forest.Ambiguous(), "Forest should be ambiguous")
+		assert.Equal(0, forest.Root().Start())
+		assert.Equal(7, forest.Root().End())
+		trees := forest.Trees(0)
+		strs := make([]string, 0, len(trees))
+		for _, i := range trees {
+			strs = append(strs, parseTreeString(i))
+			_, ok := checkParseTree(exprRules, i)
+			assert.True(ok, "Invalid parse tree")
+		}
+		sort.Strings(strs)
+		assert.Equal([]string{
+			"0(0(0(0(1) + 0(2)) + 0(3)) + 0(4))",
+			"0(0(0(1) + 0(0(2) + 0(3))) + 0(4))",
+			"0(0(0(1) + 0(2)) + 0(0(3) + 0(4)))",
+			"0(0(1) + 0(0(0(2) + 0(3)) + 0(4)))",
+			"0(0(1) + 0(0(2) + 0(0(3) + 0(4))))",
+		}, strs)
+		assert.Len(forest.Trees(2), 2, "Should limit trees")
+
+		forest.Disambiguate(leftAssoc)
+		assert.False(forest.Ambiguous(), "Forest should be disambiguated")
+		trees = forest.Trees(0)
+		assert.Len(trees, 1)
+		assert.Equal("0(0(0(0(1) + 0(2)) + 0(3)) + 0(4))", parseTreeString(trees[0]))
+	}
+	{
+		_, err := parser.Parse(tokens)
+		assert.True(errors.Is(err, ErrParse), "Ambiguous parse should fail")
+		parser, err := NewGLRParser(exprRules, E, eof, GLRParserFilter(leftAssoc))
+		assert.NoError(err, "Failed to create parser")
+		tree, err := parser.Parse(tokens)
+		assert.NoError(err, "Failed to parse")
+		assert.Equal("0(0(0(0(1) + 0(2)) + 0(3)) + 0(4))", parseTreeString(tree))
+		_, err = parser.Parse(tokens[:3])
+		assert.True(errors.Is(err, ErrParse), "Incomplete input should fail")
+		_, err = parser.Parse(append([]Token{newToken(plus.Kind(), "+")}, tokens...))
+		assert.True(errors.Is(err, ErrParse), "Invalid input should fail")
+		var perr *ParseError
+		if assert.True(errors.As(err, &perr), "Should report expected terminals") {
+			assert.Equal(0, perr.Pos())
+			_, ok := perr.NonTerm()
+			assert.False(ok, "Start state should have no nonterminal")
+			assert.Equal([]GrammarSym{num}, perr.Expected())
+		}
+		_, err = parser.Parse([]Token{newToken(num.Kind(), "1"), newToken(plus.Kind(), "+"), newToken(plus.Kind(), "+")})
+		if assert.True(errors.As(err, &perr), "Should report expected terminals") {
+			assert.Equal(2, perr.Pos())
+			nonTerm, ok := perr.NonTerm()
+			assert.True(ok, "Should report nonterminal")
+			assert.Equal(E, nonTerm)
+			assert.Equal([]GrammarSym{num}, perr.Expected())
+			assert.Equal("Unexpected token at 2: +: in n0: expected t2: parser error", err.Error())
+		}
+	}
+
+	for n, c := range []struct {
+		rules  []GrammarRule
+		start  GrammarSym
+		tokens []Token
+		exp    []string
+	}{
+		{
+			// hidden left recursion
+			rules: []GrammarRule{
+				NewGrammarRule(S, A, S, b),
+				NewGrammarRule(S, c),
+				NewGrammarRule(A),
+			},
+			start: S,
+			tokens: []Token{
+				newToken(c.Kind(), "c"),
+				newToken(b.Kind(), "b"),
+				newToken(b.Kind(), "b"),
+				newToken(eof.Kind(), ""),
+			},
+			exp: []string{
+				"4(5() 4(5() 4(c) b) b)",
+			},
+		},
+		{
+			// cyclic derivations are skipped
+			rules: []GrammarRule{
+				NewGrammarRule(S, S),
+				NewGrammarRule(S, c),
+			},
+			start: S,
+			tokens: []Token{
+				newToken(c.Kind(), "c"),
+				newToken(eof.Kind(), ""),
+			},
+			exp: []string{
+				"4(c)",
+			},
+		},
+	} {
+		parser, err := NewGLRParser(c.rules, c.start, eof)
+		assert.NoErrorf(err, "Failed to create parser: case %d", n)
+		forest, err := parser.ParseForest(c.tokens)
+		assert.NoErrorf(err, "Failed to parse: case %d, %v", n, err)
+		strs := []string{}
+		for _, i := range forest.Trees(0) {
+			strs = append(strs, parseTreeString(i))
+		}
+		assert.Equalf(c.exp, strs, "Fail case %d", n)
+	}
+}
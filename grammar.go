@@ -0,0 +1,141 @@
+package gnom
+
+import (
+	"fmt"
+	"strings"
+)
+
+type (
+	Grammar struct {
+		rules    []GrammarRule
+		start    GrammarSym
+		eof      GrammarSym
+		names    map[GrammarSym]string
+		lexer    *DfaLexer
+		checks   []GrammarCheck
+		analysis *GrammarAnalysis
+	}
+
+	GrammarOpt func(g *Grammar)
+
+	Parser interface {
+		Parse(tokens []Token) (*ParseTree, error)
+	}
+)
+
+// GrammarSymName names a symbol for use in messages
+func GrammarSymName(sym GrammarSym, name string) GrammarOpt {
+	return func(g *Grammar) {
+		g.names[sym] = name
+	}
+}
+
+// GrammarSymNames names many symbols for use in messages
+func GrammarSymNames(names map[GrammarSym]string) GrammarOpt {
+	return func(g *Grammar) {
+		for k, v := range names {
+			g.names[k] = v
+		}
+	}
+}
+
+// GrammarLexer sets the lexer producing the terminals of the grammar
+func GrammarLexer(lexer *DfaLexer) GrammarOpt {
+	return func(g *Grammar) {
+		g.lexer = lexer
+	}
+}
+
+// NewGrammar creates a grammar and validates it, returning a
+// *GrammarCheckError if it cannot be used by a parser
+func NewGrammar(rules []GrammarRule, start, eof GrammarSym, opts ...GrammarOpt) (*Grammar, error) {
+	g := &Grammar{
+		rules: append([]GrammarRule{}, rules...),
+		start: start,
+		eof:   eof,
+		names: map[GrammarSym]string{},
+	}
+	for _, i := range opts {
+		i(g)
+	}
+	checks := CheckGrammar(g.rules, g.start, g.eof)
+	if g.lexer != nil {
+		checks = append(checks, CheckGrammarLexer(g.rules, g.eof, g.lexer)...)
+	}
+	if err := checkPEGGrammarErr(checks); err != nil {
+		return nil, err
+	}
+	g.checks = checks
+	return g, nil
+}
+
+func (g *Grammar) Rules() []GrammarRule {
+	return g.rules
+}
+
+func (g *Grammar) Start() GrammarSym {
+	return g.start
+}
+
+func (g *Grammar) EOF() GrammarSym {
+	return g.eof
+}
+
+func (g *Grammar) Lexer() *DfaLexer {
+	return g.lexer
+}
+
+// Checks returns the non fatal findings of the grammar validation
+func (g *Grammar) Checks() []GrammarCheck {
+	return g.checks
+}
+
+func (g *Grammar) Analysis() *GrammarAnalysis {
+	if g.analysis == nil {
+		g.analysis = NewGrammarAnalysis(g.rules, g.start, g.eof)
+	}
+	return g.analysis
+}
+
+// Name returns the name of a symbol, falling back to its kind
+func (g *Grammar) Name(sym GrammarSym) string {
+	if v, ok := g.names[sym]; ok {
+		return v
+	}
+	return sym.String()
+}
+
+// RuleString returns the rule at index n using symbol names
+func (g *Grammar) RuleString(n int) string {
+	r := g.rules[n]
+	s := strings.Builder{}
+	s.WriteString(g.Name(r.From()))
+	s.WriteString(" ->")
+	for _, i := range r.to {
+		s.WriteString(" ")
+		s.WriteString(g.Name(i))
+	}
+	return s.String()
+}
+
+var (
+	ErrGrammarLexer = fmt.Errorf("Grammar has no lexer: %w", ErrLex)
+)
+
+// Tokenize tokenizes text with the lexer of the grammar
+func (g *Grammar) Tokenize(chars []rune) ([]Token, error) {
+	if g.lexer == nil {
+		return nil, ErrGrammarLexer
+	}
+	return g.lexer.Tokenize(chars)
+}
+
+// Parse tokenizes text with the lexer of the grammar and parses it with the
+// parser
+func (g *Grammar) Parse(p Parser, chars []rune) (*ParseTree, error) {
+	tokens, err := g.Tokenize(chars)
+	if err != nil {
+		return nil, err
+	}
+	return p.Parse(tokens)
+}
@@ -0,0 +1,325 @@
+package gnom
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type (
+	GrammarCheckKind int
+
+	GrammarCheck struct {
+		kind GrammarCheckKind
+		sym  GrammarSym
+		rule int
+	}
+
+	GrammarCheckError struct {
+		checks []GrammarCheck
+	}
+)
+
+const (
+	GrammarCheckUndefined GrammarCheckKind = iota
+	GrammarCheckUnproductive
+	GrammarCheckStartUndefined
+	GrammarCheckEOFInRule
+	GrammarCheckUnreachable
+	GrammarCheckDuplicateRule
+	GrammarCheckLexerEOF
+	GrammarCheckLexerMissingTerm
+	GrammarCheckLexerIgnoredTerm
+	GrammarCheckPEGOperator
+)
+
+func newGrammarCheck(kind GrammarCheckKind, sym GrammarSym, rule int) GrammarCheck {
+	return GrammarCheck{
+		kind: kind,
+		sym:  sym,
+		rule: rule,
+	}
+}
+
+func (c *GrammarCheck) Kind() GrammarCheckKind {
+	return c.kind
+}
+
+func (c *GrammarCheck) Sym() GrammarSym {
+	return c.sym
+}
+
+// Rule returns the index of the offending rule, or -1 if the check concerns
+// a symbol as a whole
+func (c *GrammarCheck) Rule() int {
+	return c.rule
+}
+
+// Fatal returns true if the grammar cannot be used by a parser. Unreachable
+// nonterminals and duplicate rules are reported but are not fatal. PEG
+// operators are not fatal, but are rejected by every parser except
+// PEGParser.
+func (c *GrammarCheck) Fatal() bool {
+	switch c.kind {
+	case GrammarCheckUnreachable, GrammarCheckDuplicateRule, GrammarCheckPEGOperator:
+		return false
+	default:
+		return true
+	}
+}
+
+func (c *GrammarCheck) String() string {
+	switch c.kind {
+	case GrammarCheckUndefined:
+		return fmt.Sprintf("Nonterminal lacks production rule: %d: rule %d", c.sym.Kind(), c.rule)
+	case GrammarCheckUnproductive:
+		return fmt.Sprintf("Nonterminal derives no terminal string: %d", c.sym.Kind())
+	case GrammarCheckStartUndefined:
+		return fmt.Sprintf("Start symbol lacks production rule: %d", c.sym.Kind())
+	case GrammarCheckEOFInRule:
+		return fmt.Sprintf("EOF symbol used in rule: %d", c.rule)
+	case GrammarCheckUnreachable:
+		return fmt.Sprintf("Nonterminal unreachable from start: %d", c.sym.Kind())
+	case GrammarCheckDuplicateRule:
+		return fmt.Sprintf("Duplicate rule: %d", c.rule)
+	case GrammarCheckLexerEOF:
+		return fmt.Sprintf("Lexer EOF differs from grammar EOF: %d", c.sym.Kind())
+	case GrammarCheckLexerMissingTerm:
+		return fmt.Sprintf("Terminal not produced by lexer: %d: rule %d", c.sym.Kind(), c.rule)
+	case GrammarCheckLexerIgnoredTerm:
+		return fmt.Sprintf("Terminal ignored by lexer: %d: rule %d", c.sym.Kind(), c.rule)
+	case GrammarCheckPEGOperator:
+		return fmt.Sprintf("PEG operator used in rule: %s: rule %d", c.sym, c.rule)
+	default:
+		return "Unknown grammar check"
+	}
+}
+
+func (e *GrammarCheckError) Checks() []GrammarCheck {
+	return e.checks
+}
+
+func (e *GrammarCheckError) Error() string {
+	s := strings.Builder{}
+	s.WriteString("Invalid grammar: ")
+	for n, i := range e.checks {
+		if n > 0 {
+			s.WriteString("; ")
+		}
+		s.WriteString(i.String())
+	}
+	s.WriteString(": ")
+	s.WriteString(ErrGrammar.Error())
+	return s.String()
+}
+
+func (e *GrammarCheckError) Unwrap() error {
+	return ErrGrammar
+}
+
+func sortedIntSet(m map[int]struct{}) []int {
+	s := make([]int, 0, len(m))
+	for k := range m {
+		s = append(s, k)
+	}
+	sort.Ints(s)
+	return s
+}
+
+func symsEqual(a, b []GrammarSym) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for n, i := range a {
+		if i != b[n] {
+			return false
+		}
+	}
+	return true
+}
+
+func calcProductiveSet(rules []GrammarRule) *changeIntSet {
+	set := newChangeIntSet()
+	for {
+		set.resetChanged()
+		for _, i := range rules {
+			if set.contains(i.from) {
+				continue
+			}
+			productive := true
+			for _, j := range i.to {
+				if !j.term && !set.contains(j.kind) && !pegOptional(j) {
+					productive = false
+					break
+				}
+			}
+			if productive {
+				set.upsert(i.from)
+			}
+		}
+		if !set.isChanged() {
+			return set
+		}
+	}
+}
+
+func calcReachableSet(rules []GrammarRule, start int) *changeIntSet {
+	ruleMap := map[int][]int{}
+	for n, i := range rules {
+		ruleMap[i.from] = append(ruleMap[i.from], n)
+	}
+	set := newChangeIntSet()
+	set.upsert(start)
+	stack := []int{start}
+	for len(stack) > 0 {
+		k := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for _, i := range ruleMap[k] {
+			for _, j := range rules[i].to {
+				if j.term || set.contains(j.kind) {
+					continue
+				}
+				set.upsert(j.kind)
+				stack = append(stack, j.kind)
+			}
+		}
+	}
+	return set
+}
+
+// CheckGrammar runs a sanity analysis over a grammar and returns every
+// finding in a deterministic order
+func CheckGrammar(rules []GrammarRule, start, eof GrammarSym) []GrammarCheck {
+	checks := []GrammarCheck{}
+
+	nonTerminals := newChangeIntSet()
+	for _, i := range rules {
+		nonTerminals.upsert(i.from)
+	}
+
+	if start.Term() || !nonTerminals.contains(start.Kind()) {
+		checks = append(checks, newGrammarCheck(GrammarCheckStartUndefined, start, -1))
+	}
+
+	undefined := newChangeIntSet()
+	for n, i := range rules {
+		for _, j := range i.to {
+			if j.op != PEGOpNone {
+				checks = append(checks, newGrammarCheck(GrammarCheckPEGOperator, j, n))
+			}
+			if j.term {
+				if j == eof {
+					checks = append(checks, newGrammarCheck(GrammarCheckEOFInRule, j, n))
+				}
+				continue
+			}
+			if !nonTerminals.contains(j.kind) && !undefined.contains(j.kind) {
+				undefined.upsert(j.kind)
+				checks = append(checks, newGrammarCheck(GrammarCheckUndefined, j, n))
+			}
+		}
+	}
+
+	productive := calcProductiveSet(rules)
+	for _, i := range sortedIntSet(nonTerminals.iter()) {
+		if !productive.contains(i) {
+			checks = append(checks, newGrammarCheck(GrammarCheckUnproductive, NewGrammarNonTerm(i), -1))
+		}
+	}
+
+	reachable := calcReachableSet(rules, start.Kind())
+	for _, i := range sortedIntSet(nonTerminals.iter()) {
+		if !reachable.contains(i) {
+			checks = append(checks, newGrammarCheck(GrammarCheckUnreachable, NewGrammarNonTerm(i), -1))
+		}
+	}
+
+	for n, i := range rules {
+		for _, j := range rules[:n] {
+			if i.from == j.from && symsEqual(i.to, j.to) {
+				checks = append(checks, newGrammarCheck(GrammarCheckDuplicateRule, NewGrammarNonTerm(i.from), n))
+				break
+			}
+		}
+	}
+
+	return checks
+}
+
+func calcDfaKinds(dfa *Dfa, def int) map[int]struct{} {
+	kinds := map[int]struct{}{}
+	seen := map[*Dfa]struct{}{
+		dfa: {},
+	}
+	stack := []*Dfa{dfa}
+	for len(stack) > 0 {
+		d := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if d.kind != def {
+			kinds[d.kind] = struct{}{}
+		}
+		for _, i := range d.nodes {
+			if _, ok := seen[i]; ok {
+				continue
+			}
+			seen[i] = struct{}{}
+			stack = append(stack, i)
+		}
+	}
+	return kinds
+}
+
+// CheckGrammarLexer checks that a lexer produces every terminal of a grammar
+func CheckGrammarLexer(rules []GrammarRule, eof GrammarSym, lexer *DfaLexer) []GrammarCheck {
+	checks := []GrammarCheck{}
+	if lexer.eof != eof.Kind() {
+		checks = append(checks, newGrammarCheck(GrammarCheckLexerEOF, NewGrammarTerm(lexer.eof), -1))
+	}
+	kinds := calcDfaKinds(lexer.dfa, lexer.def)
+	seen := map[int]struct{}{}
+	for n, i := range rules {
+		for _, j := range i.to {
+			if !j.term || pegControl(j) {
+				continue
+			}
+			if _, ok := seen[j.kind]; ok {
+				continue
+			}
+			seen[j.kind] = struct{}{}
+			if _, ok := lexer.ignored[j.kind]; ok {
+				checks = append(checks, newGrammarCheck(GrammarCheckLexerIgnoredTerm, j, n))
+				continue
+			}
+			if _, ok := kinds[j.kind]; !ok {
+				checks = append(checks, newGrammarCheck(GrammarCheckLexerMissingTerm, j, n))
+			}
+		}
+	}
+	return checks
+}
+
+// checkGrammarErr returns a *GrammarCheckError of the fatal checks and uses
+// of PEG operators, if any
+func checkGrammarErr(checks []GrammarCheck) error {
+	return grammarChecksErr(checks, false)
+}
+
+// checkPEGGrammarErr returns a *GrammarCheckError of the fatal checks, if any
+func checkPEGGrammarErr(checks []GrammarCheck) error {
+	return grammarChecksErr(checks, true)
+}
+
+func grammarChecksErr(checks []GrammarCheck, allowPEG bool) error {
+	fatal := []GrammarCheck{}
+	for _, i := range checks {
+		if i.Fatal() || (!allowPEG && i.kind == GrammarCheckPEGOperator) {
+			fatal = append(fatal, i)
+		}
+	}
+	if len(fatal) == 0 {
+		return nil
+	}
+	return &GrammarCheckError{
+		checks: fatal,
+	}
+}
@@ -0,0 +1,98 @@
+package gnom
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCheckGrammar(t *testing.T) {
+	assert := assert.New(t)
+
+	g := NewGrammarSymGenerator()
+
+	S := g.NonTerm()
+	eof := g.Term()
+
+	A := g.NonTerm()
+	B := g.NonTerm()
+	C := g.NonTerm()
+	D := g.NonTerm()
+	x := g.Term()
+	y := g.Term()
+
+	for n, c := range []struct {
+		rules  []GrammarRule
+		start  GrammarSym
+		checks []GrammarCheck
+		fatal  bool
+	}{
+		{
+			rules: []GrammarRule{
+				NewGrammarRule(S, A, x),
+				NewGrammarRule(A, y),
+				NewGrammarRule(A),
+			},
+			start:  S,
+			checks: []GrammarCheck{},
+		},
+		{
+			rules: []GrammarRule{
+				NewGrammarRule(S, A, x),
+				NewGrammarRule(A, y),
+				NewGrammarRule(A, y),
+				NewGrammarRule(B, x),
+			},
+			start: S,
+			checks: []GrammarCheck{
+				newGrammarCheck(GrammarCheckUnreachable, B, -1),
+				newGrammarCheck(GrammarCheckDuplicateRule, A, 2),
+			},
+		},
+		{
+			rules: []GrammarRule{
+				NewGrammarRule(S, A, D),
+				NewGrammarRule(S, B, eof),
+				NewGrammarRule(A, A, x),
+				NewGrammarRule(B, C),
+				NewGrammarRule(C, B, y),
+			},
+			start: S,
+			checks: []GrammarCheck{
+				newGrammarCheck(GrammarCheckUndefined, D, 0),
+				newGrammarCheck(GrammarCheckEOFInRule, eof, 1),
+				newGrammarCheck(GrammarCheckUnproductive, S, -1),
+				newGrammarCheck(GrammarCheckUnproductive, A, -1),
+				newGrammarCheck(GrammarCheckUnproductive, B, -1),
+				newGrammarCheck(GrammarCheckUnproductive, C, -1),
+			},
+			fatal: true,
+		},
+		{
+			rules: []GrammarRule{
+				NewGrammarRule(A, x),
+			},
+			start: S,
+			checks: []GrammarCheck{
+				newGrammarCheck(GrammarCheckStartUndefined, S, -1),
+				newGrammarCheck(GrammarCheckUnreachable, A, -1),
+			},
+			fatal: true,
+		},
+	} {
+		checks := CheckGrammar(c.rules, c.start, eof)
+		assert.Equalf(c.checks, checks, "Fail case %d", n)
+		err := checkGrammarErr(checks)
+		if !c.fatal {
+			assert.NoErrorf(err, "Fail case %d", n)
+			continue
+		}
+		assert.Errorf(err, "Should fail check: case %d", n)
+		assert.Truef(errors.Is(err, ErrGrammar), "Should fail check: case %d", n)
+		var checkErr *GrammarCheckError
+		assert.Truef(errors.As(err, &checkErr), "Should fail check: case %d", n)
+		for _, i := range checkErr.Checks() {
+			assert.Truef(i.Fatal(), "Only fatal checks should be reported: case %d", n)
+		}
+	}
+}
@@ -0,0 +1,366 @@
+package gnom
+
+import (
+	"fmt"
+)
+
+// calcEpsilonTemplates returns for each nullable nonterminal the children of
+// a shortest derivation of the empty string
+func calcEpsilonTemplates(rules []GrammarRule, nullableSet *changeIntSet) map[int][]grammarTemplate {
+	templates := map[int][]grammarTemplate{}
+	for {
+		found := map[int][]grammarTemplate{}
+		for _, i := range rules {
+			if _, ok := templates[i.from]; ok {
+				continue
+			}
+			if _, ok := found[i.from]; ok {
+				continue
+			}
+			items := make([]grammarTemplate, 0, len(i.to))
+			for _, j := range i.to {
+				if j.term {
+					items = nil
+					break
+				}
+				c, ok := templates[j.kind]
+				if !ok {
+					items = nil
+					break
+				}
+				items = append(items, templateNode(j, c))
+			}
+			if items != nil {
+				found[i.from] = items
+			}
+		}
+		if len(found) == 0 {
+			return templates
+		}
+		for k, v := range found {
+			templates[k] = v
+		}
+	}
+}
+
+// calcNonEmptySet returns the nonterminals that derive a non empty string
+func calcNonEmptySet(rules []GrammarRule) *changeIntSet {
+	set := newChangeIntSet()
+	for {
+		set.resetChanged()
+		for _, i := range rules {
+			for _, j := range i.to {
+				if j.term || set.contains(j.kind) {
+					set.upsert(i.from)
+					break
+				}
+			}
+		}
+		if !set.isChanged() {
+			return set
+		}
+	}
+}
+
+// removeEpsilon removes all rules deriving the empty string. If the start
+// symbol is nullable, a new start symbol is added with the only such rule,
+// and a unit rule to the old start symbol if it derives a non empty string.
+func (t *GrammarTransform) removeEpsilon() {
+	nullableSet := calcLL1NullableSet(t.rules)
+	nonEmptySet := calcNonEmptySet(t.rules)
+	eps := calcEpsilonTemplates(t.rules, nullableSet)
+	step := newGrammarTransformStep()
+	builder := newGrammarRuleBuilder()
+
+	if nullableSet.contains(t.start.kind) {
+		root := t.newHelper(step, grammarHelperRoot)
+		startRules := []int{}
+		for n, i := range t.rules {
+			if i.from == t.start.kind {
+				startRules = append(startRules, n)
+			}
+		}
+		if nonEmptySet.contains(t.start.kind) {
+			builder.add(root.kind, []GrammarSym{t.start}, startRules...)
+		}
+		builder.add(root.kind, []GrammarSym{}, startRules...)
+		step.addRewrite(root.kind, []GrammarSym{}, []grammarTemplate{templateNode(t.start, eps[t.start.kind])}, -1)
+		t.start = root
+	}
+
+	for n, i := range t.rules {
+		// nonterminals that only derive the empty string are always omitted
+		omitted := map[int]struct{}{}
+		nullable := []int{}
+		for m, j := range i.to {
+			if j.term || !nullableSet.contains(j.kind) {
+				continue
+			}
+			if nonEmptySet.contains(j.kind) {
+				nullable = append(nullable, m)
+			} else {
+				omitted[m] = struct{}{}
+			}
+		}
+		for mask := 0; mask < 1<<len(nullable); mask++ {
+			omit := map[int]struct{}{}
+			for k := range omitted {
+				omit[k] = struct{}{}
+			}
+			for k, m := range nullable {
+				if mask&(1<<k) != 0 {
+					omit[m] = struct{}{}
+				}
+			}
+			to := make([]GrammarSym, 0, len(i.to))
+			items := make([]grammarTemplate, 0, len(i.to))
+			for m, j := range i.to {
+				if _, ok := omit[m]; ok {
+					items = append(items, templateNode(j, eps[j.kind]))
+					continue
+				}
+				items = append(items, templateRef(len(to)))
+				to = append(to, j)
+			}
+			// a unit rule to itself derives nothing new
+			if len(to) == 0 || len(to) == 1 && !to[0].term && to[0].kind == i.from {
+				continue
+			}
+			step.addRewrite(i.from, to, items, -1)
+			builder.add(i.from, to, n)
+		}
+	}
+	t.addStep(builder, step)
+}
+
+func isUnitRule(rule GrammarRule) bool {
+	return len(rule.to) == 1 && !rule.to[0].term
+}
+
+// removeUnits replaces rules of the form A -> B with the non unit rules of
+// every nonterminal reachable from A through unit rules
+func (t *GrammarTransform) removeUnits() {
+	step := newGrammarTransformStep()
+	builder := newGrammarRuleBuilder()
+
+	ruleMap := map[int][]int{}
+	for n, i := range t.rules {
+		ruleMap[i.from] = append(ruleMap[i.from], n)
+	}
+
+	for _, a := range grammarNonTermOrder(t.rules) {
+		for _, n := range ruleMap[a] {
+			i := t.rules[n]
+			if isUnitRule(i) {
+				continue
+			}
+			step.addRewrite(a, i.to, templateRefs(0, len(i.to)), -1)
+			builder.add(a, i.to, n)
+		}
+
+		type unitPath struct {
+			syms  []GrammarSym
+			rules []int
+		}
+		paths := map[int]unitPath{
+			a: {
+				syms:  []GrammarSym{},
+				rules: []int{},
+			},
+		}
+		queue := []int{a}
+		for len(queue) > 0 {
+			b := queue[0]
+			queue = queue[1:]
+			for _, n := range ruleMap[b] {
+				i := t.rules[n]
+				if !isUnitRule(i) {
+					continue
+				}
+				c := i.to[0]
+				if _, ok := paths[c.kind]; ok {
+					continue
+				}
+				paths[c.kind] = unitPath{
+					syms:  concatSyms(paths[b].syms, []GrammarSym{c}),
+					rules: append(append([]int{}, paths[b].rules...), n),
+				}
+				queue = append(queue, c.kind)
+				for _, m := range ruleMap[c.kind] {
+					j := t.rules[m]
+					if isUnitRule(j) {
+						continue
+					}
+					items := templateRefs(0, len(j.to))
+					p := paths[c.kind]
+					for k := len(p.syms) - 1; k >= 0; k-- {
+						items = []grammarTemplate{templateNode(p.syms[k], items)}
+					}
+					step.addRewrite(a, j.to, items, -1)
+					builder.add(a, j.to, append([]int{m}, p.rules...)...)
+				}
+			}
+		}
+	}
+	t.addStep(builder, step)
+}
+
+// removeUseless removes nonterminals that derive no terminal string, and then
+// nonterminals unreachable from the start symbol
+func (t *GrammarTransform) removeUseless() {
+	productive := calcProductiveSet(t.rules)
+	builder := newGrammarRuleBuilder()
+	for n, i := range t.rules {
+		if !productive.contains(i.from) {
+			continue
+		}
+		ok := true
+		for _, j := range i.to {
+			if !j.term && !productive.contains(j.kind) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			builder.add(i.from, i.to, n)
+		}
+	}
+	t.addStep(builder, newGrammarTransformStep())
+	t.pruneUnreachable()
+}
+
+// binarize replaces terminals in rules of more than one symbol with helper
+// nonterminals, and splits rules of more than two symbols into chains of
+// helper nonterminals
+func (t *GrammarTransform) binarize() {
+	step := newGrammarTransformStep()
+	builder := newGrammarRuleBuilder()
+	lifted := map[int]GrammarSym{}
+	liftedOrder := []int{}
+	liftedProv := map[int][]int{}
+	for n, i := range t.rules {
+		if len(i.to) < 2 {
+			builder.add(i.from, i.to, n)
+			continue
+		}
+		syms := make([]GrammarSym, 0, len(i.to))
+		for _, j := range i.to {
+			if !j.term {
+				syms = append(syms, j)
+				continue
+			}
+			h, ok := lifted[j.kind]
+			if !ok {
+				h = t.newHelper(step, grammarHelperSplice)
+				lifted[j.kind] = h
+				liftedOrder = append(liftedOrder, j.kind)
+			}
+			liftedProv[j.kind] = append(liftedProv[j.kind], n)
+			syms = append(syms, h)
+		}
+		from := i.from
+		for len(syms) > 2 {
+			h := t.newHelper(step, grammarHelperSplice)
+			builder.add(from, []GrammarSym{syms[0], h}, n)
+			from = h.kind
+			syms = syms[1:]
+		}
+		builder.add(from, syms, n)
+	}
+	for _, i := range liftedOrder {
+		builder.add(lifted[i].kind, []GrammarSym{NewGrammarTerm(i)}, liftedProv[i]...)
+	}
+	t.addStep(builder, step)
+}
+
+// RemoveEpsilonRules transforms a grammar into an equivalent grammar without
+// rules deriving the empty string, other than a rule of a new start symbol if
+// the original start symbol is nullable
+func RemoveEpsilonRules(rules []GrammarRule, start GrammarSym) *GrammarTransform {
+	t := newGrammarTransform(rules, start)
+	t.removeEpsilon()
+	return t
+}
+
+// RemoveUnitRules transforms a grammar into an equivalent grammar without
+// rules of the form A -> B
+func RemoveUnitRules(rules []GrammarRule, start GrammarSym) *GrammarTransform {
+	t := newGrammarTransform(rules, start)
+	t.removeUnits()
+	return t
+}
+
+// RemoveUselessSymbols transforms a grammar into an equivalent grammar where
+// every nonterminal is reachable from the start symbol and derives a
+// terminal string
+func RemoveUselessSymbols(rules []GrammarRule, start GrammarSym) *GrammarTransform {
+	t := newGrammarTransform(rules, start)
+	t.removeUseless()
+	return t
+}
+
+func (t *GrammarTransform) toCNF() {
+	t.removeEpsilon()
+	t.removeUnits()
+	t.removeUseless()
+	t.binarize()
+}
+
+// ToCNF transforms a grammar into Chomsky normal form, where every rule is of
+// the form A -> B C or A -> a, with the exception of a rule S -> e of the
+// start symbol which does not appear in any other rule
+func ToCNF(rules []GrammarRule, start GrammarSym) *GrammarTransform {
+	t := newGrammarTransform(rules, start)
+	t.toCNF()
+	return t
+}
+
+// checkRuleLimit returns an error if the grammar has more than maxRules
+// rules, unless maxRules is not positive
+func (t *GrammarTransform) checkRuleLimit(maxRules int) error {
+	if maxRules > 0 && len(t.rules) > maxRules {
+		return fmt.Errorf("Greibach normal form exceeds %d rules: %w", maxRules, ErrGrammar)
+	}
+	return nil
+}
+
+// ToGNF transforms a grammar into Greibach normal form, where every rule is
+// of the form A -> a B1 ... Bn, with the exception of a rule S -> e of the
+// start symbol which does not appear in any other rule.
+//
+// Each rule beginning with a nonterminal is replaced by a rule for every rule
+// of the nonterminal, and identical rules are merged, yet the number of rules
+// may still grow exponentially with the size of the grammar. A grammar of 10
+// rules over 4 nonterminals may have over a million rules in Greibach normal
+// form. If maxRules is positive, the transform fails with ErrGrammar once the
+// grammar has more than maxRules rules.
+func ToGNF(rules []GrammarRule, start GrammarSym, maxRules int) (*GrammarTransform, error) {
+	t := newGrammarTransform(rules, start)
+	t.toCNF()
+	order := grammarNonTermOrder(t.rules)
+	t.removeLeftRecursion(order, false)
+	if err := t.checkRuleLimit(maxRules); err != nil {
+		return nil, err
+	}
+	for n := len(order) - 1; n >= 0; n-- {
+		for _, b := range order[n+1:] {
+			t.substitute(order[n], b)
+			if err := t.checkRuleLimit(maxRules); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, i := range grammarNonTermOrder(t.rules) {
+		if _, ok := t.helpers[i]; !ok {
+			continue
+		}
+		for _, b := range order {
+			t.substitute(i, b)
+			if err := t.checkRuleLimit(maxRules); err != nil {
+				return nil, err
+			}
+		}
+	}
+	t.pruneUnreachable()
+	return t, nil
+}
@@ -0,0 +1,230 @@
+package gnom
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestToCNF(t *testing.T) {
+	assert := assert.New(t)
+
+	g := NewGrammarSymGenerator()
+
+	E := g.NonTerm()
+	eof := g.Term()
+
+	T := g.NonTerm()
+	F := g.NonTerm()
+	num := g.Term()
+	plus := g.Term()
+	star := g.Term()
+	lparen := g.Term()
+	rparen := g.Term()
+
+	S := g.NonTerm()
+	A := g.NonTerm()
+	U := g.NonTerm()
+	a := g.Term()
+	b := g.Term()
+
+	exprRules := []GrammarRule{
+		NewGrammarRule(E, E, plus, T),
+		NewGrammarRule(E, T),
+		NewGrammarRule(T, T, star, F),
+		NewGrammarRule(T, F),
+		NewGrammarRule(F, num),
+		NewGrammarRule(F, lparen, E, rparen),
+	}
+	exprTokens := []Token{
+		newToken(num.Kind(), "1"),
+		newToken(plus.Kind(), "+"),
+		newToken(num.Kind(), "2"),
+		newToken(star.Kind(), "*"),
+		newToken(lparen.Kind(), "("),
+		newToken(num.Kind(), "3"),
+		newToken(rparen.Kind(), ")"),
+		newToken(eof.Kind(), ""),
+	}
+	balancedRules := []GrammarRule{
+		NewGrammarRule(S, a, S, b),
+		NewGrammarRule(S, A),
+		NewGrammarRule(A),
+		NewGrammarRule(U, a, U),
+	}
+
+	for n, c := range []struct {
+		rules  []GrammarRule
+		start  GrammarSym
+		gnf    bool
+		tokens []Token
+		exp    string
+	}{
+		{
+			rules:  exprRules,
+			start:  E,
+			gnf:    true,
+			tokens: exprTokens,
+			exp:    "0(0(2(3(1))) + 2(2(3(2)) * 3(( 0(2(3(3))) ))))",
+		},
+		{
+			rules: balancedRules,
+			start: S,
+			tokens: []Token{
+				newToken(a.Kind(), "a"),
+				newToken(a.Kind(), "a"),
+				newToken(b.Kind(), "b"),
+				newToken(b.Kind(), "b"),
+				newToken(eof.Kind(), ""),
+			},
+			exp: "9(a 9(a 9(10()) b) b)",
+		},
+		{
+			rules: balancedRules,
+			start: S,
+			tokens: []Token{
+				newToken(eof.Kind(), ""),
+			},
+			exp: "9(10())",
+		},
+	} {
+		for _, gnf := range []bool{false, true} {
+			if gnf && !c.gnf {
+				continue
+			}
+			var tf *GrammarTransform
+			if gnf {
+				var err error
+				tf, err = ToGNF(c.rules, c.start, 1000)
+				assert.NoErrorf(err, "Failed to transform to GNF: case %d, %v", n, err)
+			} else {
+				tf = ToCNF(c.rules, c.start)
+			}
+			start := tf.Start()
+			nullable := false
+			for _, i := range tf.Rules() {
+				if len(i.to) == 0 {
+					nullable = true
+				}
+			}
+			for _, i := range tf.Rules() {
+				if len(i.to) == 0 {
+					assert.Equalf(start.Kind(), i.from, "Only the start may derive the empty string: case %d", n)
+					continue
+				}
+				if nullable {
+					for _, j := range i.to {
+						assert.NotEqualf(start, j, "Start must not appear in rules: case %d, %s", n, i)
+					}
+				}
+				if gnf {
+					assert.Truef(i.to[0].Term(), "Rule must begin with a terminal: case %d, %s", n, i)
+					for _, j := range i.to[1:] {
+						assert.Falsef(j.Term(), "Rule must continue with nonterminals: case %d, %s", n, i)
+					}
+					continue
+				}
+				if len(i.to) == 1 {
+					assert.Truef(i.to[0].Term(), "Rule must be a terminal: case %d, %s", n, i)
+					continue
+				}
+				assert.Lenf(i.to, 2, "Rule must be two nonterminals: case %d, %s", n, i)
+				for _, j := range i.to {
+					assert.Falsef(j.Term(), "Rule must be two nonterminals: case %d, %s", n, i)
+				}
+			}
+			for _, i := range tf.Helpers() {
+				assert.NotEmptyf(tf.Origins(i), "Helper must have origins: case %d", n)
+			}
+			for m := range tf.Rules() {
+				assert.NotEmptyf(tf.RuleOrigins(m), "Rule must have origins: case %d", n)
+			}
+
+			if calcLeftRecursiveSet(tf.Rules()).contains(start.Kind()) {
+				continue
+			}
+			parser, err := NewPEGParser(tf.Rules(), tf.Start(), eof)
+			assert.NoErrorf(err, "Failed to create parser: case %d, %v", n, err)
+			tree, err := parser.Parse(c.tokens)
+			assert.NoErrorf(err, "Failed to parse: case %d, %v", n, err)
+			tree, err = tf.RestoreTree(tree)
+			assert.NoErrorf(err, "Failed to restore tree: case %d, %v", n, err)
+			assert.Equalf(c.exp, parseTreeString(tree), "Fail case %d", n)
+		}
+	}
+
+	{
+		n1 := NewGrammarNonTerm(1)
+		n2 := NewGrammarNonTerm(2)
+		n3 := NewGrammarNonTerm(3)
+		n4 := NewGrammarNonTerm(4)
+		t5 := NewGrammarTerm(5)
+		_, err := ToGNF([]GrammarRule{
+			NewGrammarRule(n1, n4, n4, n3),
+			NewGrammarRule(n1, n1, t5, n4),
+			NewGrammarRule(n1, n4),
+			NewGrammarRule(n2, t5, n1),
+			NewGrammarRule(n2, n1),
+			NewGrammarRule(n2, t5),
+			NewGrammarRule(n3, n2),
+			NewGrammarRule(n4),
+			NewGrammarRule(n4, n3, n1),
+			NewGrammarRule(n4, t5),
+		}, n1, 10000)
+		assert.True(errors.Is(err, ErrGrammar), "GNF exceeding the rule limit should fail")
+	}
+
+	tf := RemoveUselessSymbols(balancedRules, S)
+	assert.Equal([]GrammarRule{
+		NewGrammarRule(S, a, S, b),
+		NewGrammarRule(S, A),
+		NewGrammarRule(A),
+	}, tf.Rules())
+
+	tf = RemoveUnitRules(exprRules, E)
+	assert.Equal([]GrammarRule{
+		NewGrammarRule(E, E, plus, T),
+		NewGrammarRule(E, T, star, F),
+		NewGrammarRule(E, num),
+		NewGrammarRule(E, lparen, E, rparen),
+		NewGrammarRule(T, T, star, F),
+		NewGrammarRule(T, num),
+		NewGrammarRule(T, lparen, E, rparen),
+		NewGrammarRule(F, num),
+		NewGrammarRule(F, lparen, E, rparen),
+	}, tf.Rules())
+	assert.Equal([]GrammarRule{
+		exprRules[1],
+		exprRules[3],
+		exprRules[4],
+	}, tf.RuleOrigins(2))
+
+	tf = RemoveEpsilonRules(balancedRules, S)
+	assert.Equal([]GrammarRule{
+		NewGrammarRule(NewGrammarNonTerm(14), S),
+		NewGrammarRule(NewGrammarNonTerm(14), []GrammarSym{}...),
+		NewGrammarRule(S, a, S, b),
+		NewGrammarRule(S, a, b),
+		NewGrammarRule(U, a, U),
+	}, tf.Rules())
+	assert.Equal([]GrammarSym{NewGrammarNonTerm(14)}, tf.Helpers())
+
+	tf = RemoveEpsilonRules([]GrammarRule{
+		NewGrammarRule(S),
+	}, S)
+	assert.Equal([]GrammarRule{
+		NewGrammarRule(NewGrammarNonTerm(10), []GrammarSym{}...),
+	}, tf.Rules(), "Start deriving only the empty string should have no unit rule")
+
+	tf = RemoveEpsilonRules([]GrammarRule{
+		NewGrammarRule(S, S, A),
+		NewGrammarRule(S, a),
+		NewGrammarRule(A),
+		NewGrammarRule(A, b),
+	}, S)
+	assert.Equal([]GrammarRule{
+		NewGrammarRule(S, S, A),
+		NewGrammarRule(S, a),
+		NewGrammarRule(A, b),
+	}, tf.Rules(), "Should omit unit rules to the same nonterminal")
+}
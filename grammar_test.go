@@ -0,0 +1,121 @@
+package gnom
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestGrammar(t *testing.T) {
+	assert := assert.New(t)
+
+	g := NewGrammarSymGenerator()
+
+	def := g.Term()
+	eof := g.Term()
+	wspace := g.Term()
+	S := g.NonTerm()
+
+	T := g.NonTerm()
+	SP := g.NonTerm()
+	num := g.Term()
+	plus := g.Term()
+	star := g.Term()
+
+	dfa := NewDfa(def.Kind())
+	wspaceNode := NewDfa(wspace.Kind())
+	dfa.AddDfa([]rune(" "), wspaceNode)
+	wspaceNode.AddDfa([]rune(" "), wspaceNode)
+	numNode := NewDfa(num.Kind())
+	dfa.AddDfa([]rune("0123456789"), numNode)
+	numNode.AddDfa([]rune("0123456789"), numNode)
+	dfa.AddPath([]rune("+"), plus.Kind(), def.Kind())
+	lexer := NewDfaLexer(dfa, def.Kind(), eof.Kind(), map[int]struct{}{
+		wspace.Kind(): {},
+	})
+
+	rules := []GrammarRule{
+		NewGrammarRule(S, T, SP),
+		NewGrammarRule(SP, plus, T, SP),
+		NewGrammarRule(SP),
+		NewGrammarRule(T, num),
+	}
+
+	for n, c := range []struct {
+		rules  []GrammarRule
+		eof    GrammarSym
+		checks []GrammarCheckKind
+	}{
+		{
+			rules: rules,
+			eof:   eof,
+		},
+		{
+			rules: []GrammarRule{
+				NewGrammarRule(S, T, SP),
+				NewGrammarRule(SP, star, T, SP),
+				NewGrammarRule(SP),
+				NewGrammarRule(T, num, wspace),
+			},
+			eof: eof,
+			checks: []GrammarCheckKind{
+				GrammarCheckLexerMissingTerm,
+				GrammarCheckLexerIgnoredTerm,
+			},
+		},
+		{
+			rules: rules,
+			eof:   def,
+			checks: []GrammarCheckKind{
+				GrammarCheckLexerEOF,
+			},
+		},
+	} {
+		_, err := NewGrammar(c.rules, S, c.eof, GrammarLexer(lexer))
+		if len(c.checks) == 0 {
+			assert.NoErrorf(err, "Failed to create grammar: case %d, %v", n, err)
+			continue
+		}
+		assert.Errorf(err, "Should fail to create grammar: case %d", n)
+		assert.Truef(errors.Is(err, ErrGrammar), "Should fail to create grammar: case %d", n)
+		var checkErr *GrammarCheckError
+		assert.Truef(errors.As(err, &checkErr), "Should fail to create grammar: case %d", n)
+		kinds := []GrammarCheckKind{}
+		for _, i := range checkErr.Checks() {
+			kinds = append(kinds, i.Kind())
+		}
+		assert.Equalf(c.checks, kinds, "Fail case %d", n)
+	}
+
+	_, err := NewGrammar([]GrammarRule{
+		NewGrammarRule(T, num),
+	}, S, eof)
+	assert.Error(err, "Should fail to create grammar without start rules")
+
+	grammar, err := NewGrammar(rules, S, eof, GrammarLexer(lexer), GrammarSymNames(map[GrammarSym]string{
+		S:    "S",
+		SP:   "S'",
+		T:    "T",
+		plus: "+",
+	}))
+	assert.NoError(err, "Failed to create grammar")
+	assert.Equal("S' -> + T S'", grammar.RuleString(1))
+	assert.Equal("T -> t6", grammar.RuleString(3))
+	assert.Equal([]GrammarSym{SP}, grammar.Analysis().NullableSet())
+
+	ll1, err := NewLL1ParserFromGrammar(grammar)
+	assert.NoError(err, "Failed to create parser")
+	peg, err := NewPEGParserFromGrammar(grammar)
+	assert.NoError(err, "Failed to create parser")
+
+	for _, p := range []Parser{ll1, peg} {
+		tree, err := grammar.Parse(p, []rune("1 + 2 + 3"))
+		assert.NoError(err, "Failed to parse")
+		assert.Equal("3(4(1) 5(+ 4(2) 5(+ 4(3) 5())))", parseTreeString(tree))
+	}
+
+	noLexer, err := NewGrammar(rules, S, eof)
+	assert.NoError(err, "Failed to create grammar")
+	_, err = noLexer.Tokenize([]rune("1"))
+	assert.True(errors.Is(err, ErrLex), "Should fail to tokenize without a lexer")
+}
@@ -0,0 +1,749 @@
+package gnom
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	grammarHelperSplice = iota
+	grammarHelperTail
+	grammarHelperRoot
+)
+
+const (
+	grammarTemplateRef = iota
+	grammarTemplateNode
+	grammarTemplateAcc
+)
+
+type (
+	// grammarTemplate describes how to rebuild a list of nodes of the original
+	// grammar from the children of a node of the transformed grammar
+	grammarTemplate struct {
+		kind     int
+		idx      int
+		sym      GrammarSym
+		children []grammarTemplate
+	}
+
+	grammarRewrite struct {
+		items []grammarTemplate
+		tail  int
+	}
+
+	grammarTransformStep struct {
+		helpers  map[int]int
+		rewrites map[int]map[string]grammarRewrite
+	}
+
+	GrammarTransform struct {
+		orig    []GrammarRule
+		rules   []GrammarRule
+		origins [][]int
+		start   GrammarSym
+		steps   []*grammarTransformStep
+		helpers map[int]struct{}
+		g       *GrammarSymGenerator
+	}
+
+	grammarRuleBuilder struct {
+		rules []GrammarRule
+		prov  [][]int
+		index map[int]map[string]int
+	}
+)
+
+func templateRef(idx int) grammarTemplate {
+	return grammarTemplate{
+		kind: grammarTemplateRef,
+		idx:  idx,
+	}
+}
+
+func templateRefs(start, end int) []grammarTemplate {
+	items := make([]grammarTemplate, 0, end-start)
+	for i := start; i < end; i++ {
+		items = append(items, templateRef(i))
+	}
+	return items
+}
+
+func templateNode(sym GrammarSym, children []grammarTemplate) grammarTemplate {
+	return grammarTemplate{
+		kind:     grammarTemplateNode,
+		sym:      sym,
+		children: children,
+	}
+}
+
+func templateAcc() grammarTemplate {
+	return grammarTemplate{
+		kind: grammarTemplateAcc,
+	}
+}
+
+func symsKey(syms []GrammarSym) string {
+	s := strings.Builder{}
+	for _, i := range syms {
+		if i.term {
+			s.WriteByte('t')
+		} else {
+			s.WriteByte('n')
+		}
+		s.WriteString(strconv.Itoa(i.kind))
+		s.WriteByte(',')
+	}
+	return s.String()
+}
+
+func newGrammarTransformStep() *grammarTransformStep {
+	return &grammarTransformStep{
+		helpers:  map[int]int{},
+		rewrites: map[int]map[string]grammarRewrite{},
+	}
+}
+
+func (s *grammarTransformStep) addHelper(sym GrammarSym, kind int) {
+	s.helpers[sym.Kind()] = kind
+}
+
+// addRewrite records how a rule of the transformed grammar is restored. The
+// rule is identified by its nonterminal and its children once splice helpers
+// are inlined. The first rewrite recorded for a rule wins.
+func (s *grammarTransformStep) addRewrite(from int, to []GrammarSym, items []grammarTemplate, tail int) {
+	if _, ok := s.rewrites[from]; !ok {
+		s.rewrites[from] = map[string]grammarRewrite{}
+	}
+	k := symsKey(to)
+	if _, ok := s.rewrites[from][k]; ok {
+		return
+	}
+	s.rewrites[from][k] = grammarRewrite{
+		items: items,
+		tail:  tail,
+	}
+}
+
+func (s *grammarTransformStep) isHelper(node *ParseTree, kind int) bool {
+	if node.Term() {
+		return false
+	}
+	k, ok := s.helpers[node.Kind()]
+	return ok && k == kind
+}
+
+func (s *grammarTransformStep) flatten(children []*ParseTree) []*ParseTree {
+	flat := make([]*ParseTree, 0, len(children))
+	for _, i := range children {
+		if s.isHelper(i, grammarHelperSplice) {
+			flat = append(flat, s.flatten(i.children)...)
+			continue
+		}
+		flat = append(flat, i)
+	}
+	return flat
+}
+
+func (s *grammarTransformStep) lookup(kind int, children []*ParseTree) grammarRewrite {
+	if r, ok := s.rewrites[kind]; ok {
+		syms := make([]GrammarSym, 0, len(children))
+		for _, i := range children {
+			syms = append(syms, i.sym)
+		}
+		if rw, ok := r[symsKey(syms)]; ok {
+			return rw
+		}
+	}
+	return grammarRewrite{
+		items: templateRefs(0, len(children)),
+		tail:  -1,
+	}
+}
+
+func (s *grammarTransformStep) expand(items []grammarTemplate, children []*ParseTree, acc []*ParseTree) ([]*ParseTree, error) {
+	nodes := []*ParseTree{}
+	for _, i := range items {
+		switch i.kind {
+		case grammarTemplateRef:
+			if i.idx >= len(children) {
+				return nil, fmt.Errorf("Unexpected parse tree shape: %w", ErrParseInternal)
+			}
+			child, err := s.restore(children[i.idx])
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, child)
+		case grammarTemplateNode:
+			c, err := s.expand(i.children, children, acc)
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, &ParseTree{
+				sym:      i.sym,
+				children: c,
+			})
+		case grammarTemplateAcc:
+			nodes = append(nodes, acc...)
+		}
+	}
+	return nodes, nil
+}
+
+func (s *grammarTransformStep) restoreChildren(kind int, children []*ParseTree) ([]*ParseTree, error) {
+	var acc []*ParseTree
+	for {
+		flat := s.flatten(children)
+		rw := s.lookup(kind, flat)
+		nodes, err := s.expand(rw.items, flat, acc)
+		if err != nil {
+			return nil, err
+		}
+		if rw.tail < 0 {
+			return nodes, nil
+		}
+		if rw.tail >= len(flat) || !s.isHelper(flat[rw.tail], grammarHelperTail) {
+			return nil, fmt.Errorf("Unexpected parse tree shape: %w", ErrParseInternal)
+		}
+		kind = flat[rw.tail].Kind()
+		children = flat[rw.tail].children
+		acc = nodes
+	}
+}
+
+func (s *grammarTransformStep) restore(node *ParseTree) (*ParseTree, error) {
+	if node.Term() {
+		return node, nil
+	}
+	if s.isHelper(node, grammarHelperRoot) {
+		children, err := s.restoreChildren(node.Kind(), node.children)
+		if err != nil {
+			return nil, err
+		}
+		if len(children) != 1 {
+			return nil, fmt.Errorf("Unexpected parse tree shape: %w", ErrParseInternal)
+		}
+		return children[0], nil
+	}
+	if _, ok := s.helpers[node.Kind()]; ok {
+		return nil, fmt.Errorf("Unexpected parse tree shape: %w", ErrParseInternal)
+	}
+	children, err := s.restoreChildren(node.Kind(), node.children)
+	if err != nil {
+		return nil, err
+	}
+	return &ParseTree{
+		sym:      node.sym,
+		token:    node.token,
+		children: children,
+	}, nil
+}
+
+func newGrammarTransform(rules []GrammarRule, start GrammarSym) *GrammarTransform {
+	origins := make([][]int, 0, len(rules))
+	for n := range rules {
+		origins = append(origins, []int{n})
+	}
+	return &GrammarTransform{
+		orig:    rules,
+		rules:   rules,
+		origins: origins,
+		start:   start,
+		steps:   []*grammarTransformStep{},
+		helpers: map[int]struct{}{},
+		g:       newGrammarSymGeneratorAfter(rules, start),
+	}
+}
+
+func (t *GrammarTransform) Rules() []GrammarRule {
+	return t.rules
+}
+
+func (t *GrammarTransform) Start() GrammarSym {
+	return t.start
+}
+
+// RuleOrigins returns the rules of the original grammar from which rule n of
+// the transformed grammar was derived
+func (t *GrammarTransform) RuleOrigins(n int) []GrammarRule {
+	rules := make([]GrammarRule, 0, len(t.origins[n]))
+	for _, i := range t.origins[n] {
+		rules = append(rules, t.orig[i])
+	}
+	return rules
+}
+
+// Helpers returns the nonterminals of the transformed grammar that are not in
+// the original grammar sorted by kind
+func (t *GrammarTransform) Helpers() []GrammarSym {
+	set := map[int]struct{}{}
+	for _, i := range t.rules {
+		if _, ok := t.helpers[i.from]; ok {
+			set[i.from] = struct{}{}
+		}
+	}
+	return symsFromSet(set, false)
+}
+
+// Origins returns the rules of the original grammar from which the rules of a
+// helper nonterminal were derived
+func (t *GrammarTransform) Origins(sym GrammarSym) []GrammarRule {
+	set := map[int]struct{}{}
+	for n, i := range t.rules {
+		if i.from != sym.kind {
+			continue
+		}
+		for _, j := range t.origins[n] {
+			set[j] = struct{}{}
+		}
+	}
+	rules := make([]GrammarRule, 0, len(set))
+	for _, i := range sortedIntSet(set) {
+		rules = append(rules, t.orig[i])
+	}
+	return rules
+}
+
+func (t *GrammarTransform) newHelper(step *grammarTransformStep, kind int) GrammarSym {
+	sym := t.g.NonTerm()
+	step.addHelper(sym, kind)
+	t.helpers[sym.kind] = struct{}{}
+	return sym
+}
+
+func (t *GrammarTransform) addStep(b *grammarRuleBuilder, step *grammarTransformStep) {
+	origins := make([][]int, 0, len(b.prov))
+	for _, i := range b.prov {
+		set := map[int]struct{}{}
+		for _, j := range i {
+			for _, k := range t.origins[j] {
+				set[k] = struct{}{}
+			}
+		}
+		origins = append(origins, sortedIntSet(set))
+	}
+	t.rules = b.rules
+	t.origins = origins
+	t.steps = append(t.steps, step)
+}
+
+// RestoreTree rebuilds a parse tree of the transformed grammar in terms of
+// the rules of the original grammar
+func (t *GrammarTransform) RestoreTree(tree *ParseTree) (*ParseTree, error) {
+	for i := len(t.steps) - 1; i >= 0; i-- {
+		next, err := t.steps[i].restore(tree)
+		if err != nil {
+			return nil, err
+		}
+		tree = next
+	}
+	return tree, nil
+}
+
+func newGrammarRuleBuilder() *grammarRuleBuilder {
+	return &grammarRuleBuilder{
+		rules: []GrammarRule{},
+		prov:  [][]int{},
+		index: map[int]map[string]int{},
+	}
+}
+
+// add adds a rule derived from the rules at indicies prov of the previous
+// grammar, merging it with an identical rule if one exists
+func (b *grammarRuleBuilder) add(from int, to []GrammarSym, prov ...int) {
+	if _, ok := b.index[from]; !ok {
+		b.index[from] = map[string]int{}
+	}
+	k := symsKey(to)
+	if n, ok := b.index[from][k]; ok {
+		b.prov[n] = append(b.prov[n], prov...)
+		return
+	}
+	b.index[from][k] = len(b.rules)
+	b.rules = append(b.rules, GrammarRule{
+		from: from,
+		to:   to,
+	})
+	b.prov = append(b.prov, prov)
+}
+
+func concatSyms(a, b []GrammarSym) []GrammarSym {
+	s := make([]GrammarSym, 0, len(a)+len(b))
+	s = append(s, a...)
+	s = append(s, b...)
+	return s
+}
+
+// newGrammarSymGeneratorAfter returns a generator of symbols that do not
+// collide with any symbol of the grammar
+func newGrammarSymGeneratorAfter(rules []GrammarRule, syms ...GrammarSym) *GrammarSymGenerator {
+	g := NewGrammarSymGenerator()
+	bump := func(k int) {
+		if k >= g.i {
+			g.i = k + 1
+		}
+	}
+	for _, i := range syms {
+		bump(i.kind)
+	}
+	for _, i := range rules {
+		bump(i.from)
+		for _, j := range i.to {
+			bump(j.kind)
+		}
+	}
+	return g
+}
+
+func grammarNonTermOrder(rules []GrammarRule) []int {
+	order := []int{}
+	seen := map[int]struct{}{}
+	for _, i := range rules {
+		if _, ok := seen[i.from]; ok {
+			continue
+		}
+		seen[i.from] = struct{}{}
+		order = append(order, i.from)
+	}
+	return order
+}
+
+func calcLeftCornerSet(rules []GrammarRule, nullableSet *changeIntSet) *changeIntIntSet {
+	set := newChangeIntIntSet()
+	for _, i := range rules {
+		for _, j := range i.to {
+			if j.term {
+				break
+			}
+			set.upsert(i.from, j.kind)
+			if !nullableSet.contains(j.kind) {
+				break
+			}
+		}
+	}
+	for {
+		set.resetChanged()
+		for a, m := range set.set {
+			for b := range m {
+				set.upsertAll(a, set.iter(b))
+			}
+		}
+		if !set.isChanged() {
+			return set
+		}
+	}
+}
+
+// calcLeftRecursiveSet returns the nonterminals A such that A derives A x for
+// some string x, accounting for nullable prefixes
+func calcLeftRecursiveSet(rules []GrammarRule) *changeIntSet {
+	leftCorner := calcLeftCornerSet(rules, calcLL1NullableSet(rules))
+	set := newChangeIntSet()
+	for a, m := range leftCorner.set {
+		if _, ok := m[a]; ok {
+			set.upsert(a)
+		}
+	}
+	return set
+}
+
+// calcCyclicSet returns the nonterminals A such that A derives A, which is the
+// case if A derives B x C for some nonterminal B deriving A and nullable
+// strings x and C
+func calcCyclicSet(rules []GrammarRule) *changeIntSet {
+	nullableSet := calcLL1NullableSet(rules)
+	units := newChangeIntIntSet()
+	for _, i := range rules {
+		for n, j := range i.to {
+			if j.term {
+				break
+			}
+			if isLL1Nullable(i.to[n+1:], nullableSet) {
+				units.upsert(i.from, j.kind)
+			}
+			if !nullableSet.contains(j.kind) {
+				break
+			}
+		}
+	}
+	for {
+		units.resetChanged()
+		for a, m := range units.set {
+			for b := range m {
+				units.upsertAll(a, units.iter(b))
+			}
+		}
+		if !units.isChanged() {
+			break
+		}
+	}
+	set := newChangeIntSet()
+	for a, m := range units.set {
+		if _, ok := m[a]; ok {
+			set.upsert(a)
+		}
+	}
+	return set
+}
+
+// pruneUnreachable removes the rules of nonterminals that are no longer
+// reachable from the start symbol, since they would otherwise contribute to
+// FOLLOW sets
+func (t *GrammarTransform) pruneUnreachable() {
+	reachable := calcReachableSet(t.rules, t.start.kind)
+	b := newGrammarRuleBuilder()
+	for n, i := range t.rules {
+		if reachable.contains(i.from) {
+			b.add(i.from, i.to, n)
+		}
+	}
+	t.addStep(b, newGrammarTransformStep())
+}
+
+func leadsWith(rule GrammarRule, kind int) bool {
+	return len(rule.to) > 0 && !rule.to[0].term && rule.to[0].kind == kind
+}
+
+// substitute replaces the rules of a that begin with b with rules beginning
+// with each alternative of b
+func (t *GrammarTransform) substitute(a, b int) bool {
+	changed := false
+	for _, i := range t.rules {
+		if i.from == a && leadsWith(i, b) {
+			changed = true
+			break
+		}
+	}
+	if !changed {
+		return false
+	}
+	step := newGrammarTransformStep()
+	builder := newGrammarRuleBuilder()
+	sym := NewGrammarNonTerm(b)
+	for n, i := range t.rules {
+		if i.from != a || !leadsWith(i, b) {
+			builder.add(i.from, i.to, n)
+			continue
+		}
+		gamma := i.to[1:]
+		for m, j := range t.rules {
+			if j.from != b {
+				continue
+			}
+			to := concatSyms(j.to, gamma)
+			items := []grammarTemplate{templateNode(sym, templateRefs(0, len(j.to)))}
+			items = append(items, templateRefs(len(j.to), len(to))...)
+			step.addRewrite(a, to, items, -1)
+			builder.add(a, to, n, m)
+		}
+	}
+	t.addStep(builder, step)
+	return true
+}
+
+// eliminateDirectLeftRecursion rewrites A -> A a | b as A -> b A', A' -> a A'
+// | e. If nullable is false, the rules A -> b | b A', A' -> a | a A' are used
+// instead.
+func (t *GrammarTransform) eliminateDirectLeftRecursion(a int, nullable bool) bool {
+	recursive := false
+	for _, i := range t.rules {
+		if i.from == a && leadsWith(i, a) {
+			recursive = true
+			break
+		}
+	}
+	if !recursive {
+		return false
+	}
+
+	step := newGrammarTransformStep()
+	tail := t.newHelper(step, grammarHelperTail)
+	sym := NewGrammarNonTerm(a)
+
+	builder := newGrammarRuleBuilder()
+	tailBuilder := newGrammarRuleBuilder()
+	recursiveRules := []int{}
+	for n, i := range t.rules {
+		if i.from != a {
+			builder.add(i.from, i.to, n)
+			continue
+		}
+		if !leadsWith(i, a) {
+			to := concatSyms(i.to, []GrammarSym{tail})
+			step.addRewrite(a, to, templateRefs(0, len(i.to)), len(i.to))
+			builder.add(a, to, n)
+			if !nullable {
+				builder.add(a, i.to, n)
+			}
+			continue
+		}
+		alpha := i.to[1:]
+		if len(alpha) == 0 {
+			// A -> A adds nothing to the language
+			continue
+		}
+		recursiveRules = append(recursiveRules, n)
+		items := []grammarTemplate{templateNode(sym, []grammarTemplate{templateAcc()})}
+		items = append(items, templateRefs(0, len(alpha))...)
+		to := concatSyms(alpha, []GrammarSym{tail})
+		step.addRewrite(tail.kind, to, items, len(alpha))
+		tailBuilder.add(tail.kind, to, n)
+		if !nullable {
+			step.addRewrite(tail.kind, alpha, items, -1)
+			tailBuilder.add(tail.kind, alpha, n)
+		}
+	}
+	if nullable {
+		step.addRewrite(tail.kind, []GrammarSym{}, []grammarTemplate{templateAcc()}, -1)
+		tailBuilder.add(tail.kind, []GrammarSym{}, recursiveRules...)
+	}
+	for n, i := range tailBuilder.rules {
+		builder.add(i.from, i.to, tailBuilder.prov[n]...)
+	}
+	t.addStep(builder, step)
+	return true
+}
+
+// removeLeftRecursion applies the substitutions and eliminations of direct
+// left recursion of Paull's algorithm to the nonterminals in order
+func (t *GrammarTransform) removeLeftRecursion(order []int, nullable bool) {
+	for n, a := range order {
+		// substituting a nullable nonterminal may expose another leading
+		// nonterminal that has already been processed
+		for pass := 0; pass <= n; pass++ {
+			changed := false
+			for _, b := range order[:n] {
+				if t.substitute(a, b) {
+					changed = true
+				}
+			}
+			if !changed {
+				break
+			}
+		}
+		t.eliminateDirectLeftRecursion(a, nullable)
+	}
+}
+
+// EliminateLeftRecursion transforms a grammar into an equivalent grammar
+// without direct or indirect left recursion. Parse trees of the transformed
+// grammar may be rebuilt as trees of the original grammar with RestoreTree.
+//
+// Substitution only exposes left recursion hidden behind a nullable prefix,
+// as in S -> B S a with B nullable, if the nullable nonterminal is ordered
+// before the recursive one. If left recursion remains, the transform is
+// retried after removing the rules deriving the empty string, which leaves no
+// nullable prefixes, so that the result does not depend on the order of the
+// rules. Only left recursion reachable from the start symbol is considered.
+//
+// A cyclic grammar, in which some nonterminal A derives A, has no equivalent
+// grammar without left recursion, and ErrGrammar is returned for it.
+func EliminateLeftRecursion(rules []GrammarRule, start GrammarSym) (*GrammarTransform, error) {
+	reachable := calcReachableSet(rules, start.kind)
+	cyclic := []int{}
+	for _, i := range sortedIntSet(calcCyclicSet(rules).iter()) {
+		if reachable.contains(i) {
+			cyclic = append(cyclic, i)
+		}
+	}
+	if len(cyclic) > 0 {
+		return nil, fmt.Errorf("Unable to eliminate left recursion of cyclic nonterminals: %v: %w", cyclic, ErrGrammar)
+	}
+
+	t := newGrammarTransform(rules, start)
+	t.removeLeftRecursion(grammarNonTermOrder(rules), true)
+	t.pruneUnreachable()
+	if len(calcLeftRecursiveSet(t.rules).iter()) > 0 {
+		t = newGrammarTransform(rules, start)
+		t.removeEpsilon()
+		t.removeLeftRecursion(grammarNonTermOrder(t.rules), true)
+		t.pruneUnreachable()
+	}
+	if remaining := calcLeftRecursiveSet(t.rules); len(remaining.iter()) > 0 {
+		return nil, fmt.Errorf("Unable to eliminate left recursion: %v: %w", sortedIntSet(remaining.iter()), ErrGrammar)
+	}
+	return t, nil
+}
+
+func commonPrefixLen(a, b []GrammarSym) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	return n
+}
+
+// LeftFactor transforms a grammar such that no two alternatives of a
+// nonterminal share a common prefix of symbols, by moving the differing
+// suffixes into helper nonterminals. Only syntactically equal prefixes are
+// factored. Parse trees of the transformed grammar may be rebuilt as trees of
+// the original grammar with RestoreTree.
+func LeftFactor(rules []GrammarRule, start GrammarSym) *GrammarTransform {
+	t := newGrammarTransform(rules, start)
+	step := newGrammarTransformStep()
+
+	type alt struct {
+		to   []GrammarSym
+		prov []int
+	}
+	alts := map[int][]alt{}
+	order := grammarNonTermOrder(rules)
+	for n, i := range rules {
+		alts[i.from] = append(alts[i.from], alt{
+			to:   i.to,
+			prov: []int{n},
+		})
+	}
+
+	builder := newGrammarRuleBuilder()
+	for len(order) > 0 {
+		a := order[0]
+		order = order[1:]
+		used := make([]bool, len(alts[a]))
+		for n, i := range alts[a] {
+			if used[n] {
+				continue
+			}
+			used[n] = true
+			if len(i.to) == 0 {
+				builder.add(a, i.to, i.prov...)
+				continue
+			}
+			group := []alt{i}
+			prefix := len(i.to)
+			for m := n + 1; m < len(alts[a]); m++ {
+				if used[m] {
+					continue
+				}
+				j := alts[a][m]
+				if len(j.to) == 0 || j.to[0] != i.to[0] {
+					continue
+				}
+				used[m] = true
+				group = append(group, j)
+				if k := commonPrefixLen(i.to, j.to); k < prefix {
+					prefix = k
+				}
+			}
+			if len(group) == 1 {
+				builder.add(a, i.to, i.prov...)
+				continue
+			}
+			helper := t.newHelper(step, grammarHelperSplice)
+			prov := []int{}
+			for _, j := range group {
+				alts[helper.kind] = append(alts[helper.kind], alt{
+					to:   j.to[prefix:],
+					prov: j.prov,
+				})
+				prov = append(prov, j.prov...)
+			}
+			builder.add(a, concatSyms(i.to[:prefix], []GrammarSym{helper}), prov...)
+			order = append(order, helper.kind)
+		}
+	}
+
+	t.addStep(builder, step)
+	return t
+}
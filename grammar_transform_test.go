@@ -0,0 +1,302 @@
+package gnom
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func parseTreeString(t *ParseTree) string {
+	if t.Term() {
+		return t.Val()
+	}
+	s := strings.Builder{}
+	s.WriteString(strconv.Itoa(t.Kind()))
+	s.WriteString("(")
+	for n, i := range t.Children() {
+		if n > 0 {
+			s.WriteString(" ")
+		}
+		s.WriteString(parseTreeString(i))
+	}
+	s.WriteString(")")
+	return s.String()
+}
+
+func TestEliminateLeftRecursion(t *testing.T) {
+	assert := assert.New(t)
+
+	g := NewGrammarSymGenerator()
+
+	E := g.NonTerm()
+	eof := g.Term()
+
+	T := g.NonTerm()
+	F := g.NonTerm()
+	num := g.Term()
+	plus := g.Term()
+	star := g.Term()
+	lparen := g.Term()
+	rparen := g.Term()
+
+	S := g.NonTerm()
+	A := g.NonTerm()
+	a := g.Term()
+	b := g.Term()
+	c := g.Term()
+	d := g.Term()
+
+	B := g.NonTerm()
+
+	exprRules := []GrammarRule{
+		NewGrammarRule(E, E, plus, T),
+		NewGrammarRule(E, T),
+		NewGrammarRule(T, T, star, F),
+		NewGrammarRule(T, F),
+		NewGrammarRule(F, num),
+		NewGrammarRule(F, lparen, E, rparen),
+	}
+	indirectRules := []GrammarRule{
+		NewGrammarRule(A, S, c),
+		NewGrammarRule(A, d),
+		NewGrammarRule(S, A, a),
+		NewGrammarRule(S, b),
+	}
+
+	_, err := NewLL1Parser(exprRules, E, eof)
+	assert.Error(err, "Left recursive grammar should not be LL1")
+	{
+		tf, err := EliminateLeftRecursion(exprRules, E)
+		assert.NoError(err, "Failed to transform")
+		_, err = NewLL1Parser(tf.Rules(), tf.Start(), eof)
+		assert.NoError(err, "Transformed grammar should be LL1")
+	}
+
+	for n, c := range []struct {
+		rules  []GrammarRule
+		start  GrammarSym
+		tokens []Token
+		err    error
+		exp    string
+	}{
+		{
+			rules: exprRules,
+			start: E,
+			tokens: []Token{
+				newToken(num.Kind(), "1"),
+				newToken(plus.Kind(), "+"),
+				newToken(num.Kind(), "2"),
+				newToken(star.Kind(), "*"),
+				newToken(num.Kind(), "3"),
+				newToken(star.Kind(), "*"),
+				newToken(lparen.Kind(), "("),
+				newToken(num.Kind(), "4"),
+				newToken(plus.Kind(), "+"),
+				newToken(num.Kind(), "5"),
+				newToken(rparen.Kind(), ")"),
+				newToken(plus.Kind(), "+"),
+				newToken(num.Kind(), "6"),
+				newToken(eof.Kind(), ""),
+			},
+			exp: "0(0(0(2(3(1))) + 2(2(2(3(2)) * 3(3)) * 3(( 0(0(2(3(4))) + 2(3(5))) )))) + 2(3(6)))",
+		},
+		{
+			rules: indirectRules,
+			start: S,
+			tokens: []Token{
+				newToken(d.Kind(), "d"),
+				newToken(a.Kind(), "a"),
+				newToken(c.Kind(), "c"),
+				newToken(a.Kind(), "a"),
+				newToken(eof.Kind(), ""),
+			},
+			exp: "9(10(9(10(d) a) c) a)",
+		},
+		{
+			rules: []GrammarRule{
+				NewGrammarRule(B),
+				NewGrammarRule(B, c, d),
+				NewGrammarRule(S, B, S, a),
+				NewGrammarRule(S, b),
+			},
+			start: S,
+			tokens: []Token{
+				newToken(c.Kind(), "c"),
+				newToken(d.Kind(), "d"),
+				newToken(b.Kind(), "b"),
+				newToken(a.Kind(), "a"),
+				newToken(a.Kind(), "a"),
+				newToken(eof.Kind(), ""),
+			},
+			exp: "9(15(c d) 9(15() 9(b) a) a)",
+		},
+		{
+			// hidden left recursion is eliminated regardless of rule order
+			rules: []GrammarRule{
+				NewGrammarRule(S, B, S, a),
+				NewGrammarRule(S, b),
+				NewGrammarRule(B),
+				NewGrammarRule(B, c, d),
+			},
+			start: S,
+			tokens: []Token{
+				newToken(c.Kind(), "c"),
+				newToken(d.Kind(), "d"),
+				newToken(b.Kind(), "b"),
+				newToken(a.Kind(), "a"),
+				newToken(a.Kind(), "a"),
+				newToken(eof.Kind(), ""),
+			},
+			exp: "9(15(c d) 9(15() 9(b) a) a)",
+		},
+		{
+			rules: []GrammarRule{
+				NewGrammarRule(S, B, S, a),
+				NewGrammarRule(S, b),
+				NewGrammarRule(B, S, c),
+				NewGrammarRule(B),
+			},
+			start: B,
+			tokens: []Token{
+				newToken(b.Kind(), "b"),
+				newToken(a.Kind(), "a"),
+				newToken(c.Kind(), "c"),
+				newToken(eof.Kind(), ""),
+			},
+			exp: "15(9(15() 9(b) a) c)",
+		},
+		{
+			rules: []GrammarRule{
+				NewGrammarRule(B, S, c),
+				NewGrammarRule(B),
+				NewGrammarRule(S, B, S, a),
+				NewGrammarRule(S, b),
+			},
+			start: B,
+			tokens: []Token{
+				newToken(eof.Kind(), ""),
+			},
+			exp: "15()",
+		},
+		{
+			// unreachable left recursion is pruned
+			rules: []GrammarRule{
+				NewGrammarRule(A),
+				NewGrammarRule(S, B, S, a),
+				NewGrammarRule(S, b),
+				NewGrammarRule(B),
+				NewGrammarRule(B, c, d),
+			},
+			start: A,
+			tokens: []Token{
+				newToken(eof.Kind(), ""),
+			},
+			exp: "10()",
+		},
+		{
+			// cyclic grammars have no equivalent grammar without left
+			// recursion
+			rules: []GrammarRule{
+				NewGrammarRule(S, A),
+				NewGrammarRule(S, a),
+				NewGrammarRule(A, S),
+			},
+			start: S,
+			err:   ErrGrammar,
+		},
+	} {
+		tf, err := EliminateLeftRecursion(c.rules, c.start)
+		if c.err != nil {
+			assert.Errorf(err, "Should fail to transform: case %d", n)
+			assert.Truef(errors.Is(err, c.err), "Should fail to transform: case %d", n)
+			continue
+		}
+		assert.NoErrorf(err, "Failed to transform: case %d, %v", n, err)
+		assert.Emptyf(calcLeftRecursiveSet(tf.Rules()).iter(), "Left recursion remains: case %d", n)
+		parser, err := NewPEGParser(tf.Rules(), tf.Start(), eof)
+		assert.NoErrorf(err, "Failed to create parser: case %d, %v", n, err)
+		tree, err := parser.Parse(c.tokens)
+		assert.NoErrorf(err, "Failed to parse: case %d, %v", n, err)
+		tree, err = tf.RestoreTree(tree)
+		assert.NoErrorf(err, "Failed to restore tree: case %d, %v", n, err)
+		assert.Equalf(c.exp, parseTreeString(tree), "Fail case %d", n)
+	}
+}
+
+func TestLeftFactor(t *testing.T) {
+	assert := assert.New(t)
+
+	g := NewGrammarSymGenerator()
+
+	S := g.NonTerm()
+	eof := g.Term()
+
+	E := g.NonTerm()
+	kif := g.Term()
+	kthen := g.Term()
+	kelse := g.Term()
+	kend := g.Term()
+	other := g.Term()
+	b := g.Term()
+	c := g.Term()
+
+	rules := []GrammarRule{
+		NewGrammarRule(S, kif, E, kthen, S, kend),
+		NewGrammarRule(S, kif, E, kthen, S, kelse, S, kend),
+		NewGrammarRule(S, other),
+		NewGrammarRule(E, b),
+		NewGrammarRule(E, b, c),
+		NewGrammarRule(E, b, b),
+	}
+
+	_, err := NewLL1Parser(rules, S, eof)
+	assert.Error(err, "Grammar with common prefixes should not be LL1")
+
+	tf := LeftFactor(rules, S)
+	parser, err := NewLL1Parser(tf.Rules(), tf.Start(), eof)
+	assert.NoErrorf(err, "Failed to create parser: %v", err)
+
+	for n, c := range []struct {
+		tokens []Token
+		exp    string
+	}{
+		{
+			tokens: []Token{
+				newToken(kif.Kind(), "if"),
+				newToken(b.Kind(), "b"),
+				newToken(kthen.Kind(), "then"),
+				newToken(other.Kind(), "x"),
+				newToken(kend.Kind(), "end"),
+				newToken(eof.Kind(), ""),
+			},
+			exp: "0(if 2(b) then 0(x) end)",
+		},
+		{
+			tokens: []Token{
+				newToken(kif.Kind(), "if"),
+				newToken(b.Kind(), "b"),
+				newToken(c.Kind(), "c"),
+				newToken(kthen.Kind(), "then"),
+				newToken(other.Kind(), "x"),
+				newToken(kelse.Kind(), "else"),
+				newToken(kif.Kind(), "if"),
+				newToken(b.Kind(), "b"),
+				newToken(b.Kind(), "b"),
+				newToken(kthen.Kind(), "then"),
+				newToken(other.Kind(), "y"),
+				newToken(kend.Kind(), "end"),
+				newToken(kend.Kind(), "end"),
+				newToken(eof.Kind(), ""),
+			},
+			exp: "0(if 2(b c) then 0(x) else 0(if 2(b b) then 0(y) end) end)",
+		},
+	} {
+		tree, err := parser.Parse(c.tokens)
+		assert.NoErrorf(err, "Failed to parse: case %d, %v", n, err)
+		tree, err = tf.RestoreTree(tree)
+		assert.NoErrorf(err, "Failed to restore tree: case %d, %v", n, err)
+		assert.Equalf(c.exp, parseTreeString(tree), "Fail case %d", n)
+	}
+}
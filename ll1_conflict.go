@@ -0,0 +1,267 @@
+package gnom
+
+import (
+	"fmt"
+	"strings"
+)
+
+type (
+	LL1ConflictSource int
+
+	LL1ConflictProduction struct {
+		rule   int
+		source LL1ConflictSource
+		path   []int
+	}
+
+	LL1Conflict struct {
+		nonTerm     GrammarSym
+		lookahead   GrammarSym
+		productions [2]LL1ConflictProduction
+		rules       []GrammarRule
+	}
+
+	LL1ConflictError struct {
+		conflicts []LL1Conflict
+	}
+
+	ll1TableEntry struct {
+		rule   int
+		source LL1ConflictSource
+	}
+)
+
+const (
+	LL1ConflictFirst LL1ConflictSource = iota
+	LL1ConflictFollow
+)
+
+func (s LL1ConflictSource) String() string {
+	switch s {
+	case LL1ConflictFirst:
+		return "FIRST"
+	case LL1ConflictFollow:
+		return "FOLLOW"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// Rule returns the index of the competing rule
+func (p *LL1ConflictProduction) Rule() int {
+	return p.rule
+}
+
+// Source returns whether the lookahead is in the FIRST set of the rule, or
+// in the FOLLOW set of its nonterminal when the rule is nullable
+func (p *LL1ConflictProduction) Source() LL1ConflictSource {
+	return p.source
+}
+
+// Path returns the indices of the rules used to derive the lookahead from the
+// competing rule. For a FIRST conflict, each rule expands the leftmost
+// non-nullable symbol of the previous one. For a FOLLOW conflict, the rules
+// after the competing rule first show where its nonterminal is used, up to a
+// rule where the lookahead may follow it, and then expand the lookahead as in
+// a FIRST conflict.
+func (p *LL1ConflictProduction) Path() []int {
+	return p.path
+}
+
+func (c *LL1Conflict) NonTerm() GrammarSym {
+	return c.nonTerm
+}
+
+func (c *LL1Conflict) Lookahead() GrammarSym {
+	return c.lookahead
+}
+
+func (c *LL1Conflict) Productions() [2]LL1ConflictProduction {
+	return c.productions
+}
+
+func (c *LL1Conflict) String() string {
+	s := strings.Builder{}
+	fmt.Fprintf(&s, "Conflict for %s on %s", c.nonTerm, c.lookahead)
+	for _, i := range c.productions {
+		fmt.Fprintf(&s, ": rule %d by %s (", i.rule, i.source)
+		for n, j := range i.path {
+			if n > 0 {
+				s.WriteString(", ")
+			}
+			s.WriteString(c.rules[j].String())
+		}
+		s.WriteString(")")
+	}
+	return s.String()
+}
+
+func (e *LL1ConflictError) Conflicts() []LL1Conflict {
+	return e.conflicts
+}
+
+func (e *LL1ConflictError) Error() string {
+	s := strings.Builder{}
+	s.WriteString("Grammar is not LL1")
+	for _, i := range e.conflicts {
+		s.WriteString(": ")
+		s.WriteString(i.String())
+	}
+	s.WriteString(": ")
+	s.WriteString(ErrGrammar.Error())
+	return s.String()
+}
+
+func (e *LL1ConflictError) Unwrap() error {
+	return ErrGrammar
+}
+
+type (
+	// ll1Witness finds short derivations explaining why a terminal is in a
+	// FIRST or FOLLOW set
+	ll1Witness struct {
+		rules       []GrammarRule
+		start       int
+		eof         int
+		nullableSet *changeIntSet
+		first       map[int]map[int][]int
+		follow      map[int]map[int][]int
+	}
+)
+
+func newLL1Witness(rules []GrammarRule, start, eof int, nullableSet *changeIntSet) *ll1Witness {
+	return &ll1Witness{
+		rules:       rules,
+		start:       start,
+		eof:         eof,
+		nullableSet: nullableSet,
+		first:       map[int]map[int][]int{},
+		follow:      map[int]map[int][]int{},
+	}
+}
+
+func concatPath(a int, b []int) []int {
+	path := make([]int, 0, len(b)+1)
+	path = append(path, a)
+	path = append(path, b...)
+	return path
+}
+
+func (w *ll1Witness) seqFirstPath(syms []GrammarSym, t int, paths map[int][]int) ([]int, bool) {
+	for _, i := range syms {
+		if i.term {
+			if i.kind == t {
+				return []int{}, true
+			}
+			return nil, false
+		}
+		if p, ok := paths[i.kind]; ok {
+			return p, true
+		}
+		if !w.nullableSet.contains(i.kind) {
+			return nil, false
+		}
+	}
+	return nil, false
+}
+
+// firstPaths returns, for each nonterminal deriving a string starting with t,
+// the shortest sequence of rules doing so
+func (w *ll1Witness) firstPaths(t int) map[int][]int {
+	if paths, ok := w.first[t]; ok {
+		return paths
+	}
+	paths := map[int][]int{}
+	for {
+		found := map[int][]int{}
+		for n, i := range w.rules {
+			if _, ok := paths[i.from]; ok {
+				continue
+			}
+			if _, ok := found[i.from]; ok {
+				continue
+			}
+			if p, ok := w.seqFirstPath(i.to, t, paths); ok {
+				found[i.from] = concatPath(n, p)
+			}
+		}
+		if len(found) == 0 {
+			break
+		}
+		for k, v := range found {
+			paths[k] = v
+		}
+	}
+	w.first[t] = paths
+	return paths
+}
+
+// followPaths returns, for each nonterminal which may be followed by t, the
+// shortest sequence of rules showing so
+func (w *ll1Witness) followPaths(t int) map[int][]int {
+	if paths, ok := w.follow[t]; ok {
+		return paths
+	}
+	firstPaths := w.firstPaths(t)
+	paths := map[int][]int{}
+	if t == w.eof {
+		paths[w.start] = []int{}
+	}
+	for {
+		found := map[int][]int{}
+		for n, i := range w.rules {
+			for m, j := range i.to {
+				if j.term {
+					continue
+				}
+				if _, ok := paths[j.kind]; ok {
+					continue
+				}
+				if _, ok := found[j.kind]; ok {
+					continue
+				}
+				rest := i.to[m+1:]
+				if p, ok := w.seqFirstPath(rest, t, firstPaths); ok {
+					found[j.kind] = concatPath(n, p)
+					continue
+				}
+				if !isLL1Nullable(rest, w.nullableSet) {
+					continue
+				}
+				if p, ok := paths[i.from]; ok {
+					found[j.kind] = concatPath(n, p)
+				}
+			}
+		}
+		if len(found) == 0 {
+			break
+		}
+		for k, v := range found {
+			paths[k] = v
+		}
+	}
+	w.follow[t] = paths
+	return paths
+}
+
+func (w *ll1Witness) production(rule int, t int, source LL1ConflictSource) LL1ConflictProduction {
+	var path []int
+	r := w.rules[rule]
+	if source == LL1ConflictFirst {
+		if p, ok := w.seqFirstPath(r.to, t, w.firstPaths(t)); ok {
+			path = concatPath(rule, p)
+		}
+	} else {
+		if p, ok := w.followPaths(t)[r.from]; ok {
+			path = concatPath(rule, p)
+		}
+	}
+	if path == nil {
+		path = []int{rule}
+	}
+	return LL1ConflictProduction{
+		rule:   rule,
+		source: source,
+		path:   path,
+	}
+}
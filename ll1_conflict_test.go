@@ -0,0 +1,80 @@
+package gnom
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestLL1ConflictError(t *testing.T) {
+	assert := assert.New(t)
+
+	g := NewGrammarSymGenerator()
+
+	S := g.NonTerm()
+	eof := g.Term()
+
+	A := g.NonTerm()
+	C := g.NonTerm()
+	D := g.NonTerm()
+	a := g.Term()
+	b := g.Term()
+	c := g.Term()
+
+	rules := []GrammarRule{
+		NewGrammarRule(S, A, b),
+		NewGrammarRule(A, C),
+		NewGrammarRule(A, b),
+		NewGrammarRule(C, a),
+		NewGrammarRule(C),
+		NewGrammarRule(S, D),
+		NewGrammarRule(D, a, c),
+	}
+
+	_, err := NewLL1Parser(rules, S, eof)
+	assert.Error(err, "Should fail to create parser")
+	assert.True(errors.Is(err, ErrGrammar), "Should fail to create parser")
+	var conflictErr *LL1ConflictError
+	assert.True(errors.As(err, &conflictErr), "Should report conflicts")
+
+	type prod struct {
+		rule   int
+		source LL1ConflictSource
+		path   []int
+	}
+	exp := []struct {
+		nonTerm   GrammarSym
+		lookahead GrammarSym
+		prods     [2]prod
+	}{
+		{
+			nonTerm:   A,
+			lookahead: b,
+			prods: [2]prod{
+				{rule: 1, source: LL1ConflictFollow, path: []int{1, 0}},
+				{rule: 2, source: LL1ConflictFirst, path: []int{2}},
+			},
+		},
+		{
+			nonTerm:   S,
+			lookahead: a,
+			prods: [2]prod{
+				{rule: 0, source: LL1ConflictFirst, path: []int{0, 1, 3}},
+				{rule: 5, source: LL1ConflictFirst, path: []int{5, 6}},
+			},
+		},
+	}
+
+	conflicts := conflictErr.Conflicts()
+	assert.Len(conflicts, len(exp), "Should report every conflict")
+	for n, i := range conflicts {
+		assert.Equalf(exp[n].nonTerm, i.NonTerm(), "Fail case %d", n)
+		assert.Equalf(exp[n].lookahead, i.Lookahead(), "Fail case %d", n)
+		for m, j := range i.Productions() {
+			assert.Equalf(exp[n].prods[m].rule, j.Rule(), "Fail case %d %d", n, m)
+			assert.Equalf(exp[n].prods[m].source, j.Source(), "Fail case %d %d", n, m)
+			assert.Equalf(exp[n].prods[m].path, j.Path(), "Fail case %d %d", n, m)
+		}
+	}
+	assert.Equal("Grammar is not LL1: Conflict for n2 on t6: rule 1 by FOLLOW (n2 -> n3, n0 -> n2 t6): rule 2 by FIRST (n2 -> t6): Conflict for n0 on t5: rule 0 by FIRST (n0 -> n2 t6, n2 -> n3, n3 -> t5): rule 5 by FIRST (n0 -> n4, n4 -> t5 t7): grammar error", err.Error())
+}
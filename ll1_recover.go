@@ -0,0 +1,163 @@
+package gnom
+
+import (
+	"errors"
+)
+
+// LL1ParserSync adds synchronization terminals, such as statement
+// terminators and closing delimiters, at which ParseRecover resumes parsing
+// after an error in addition to the FOLLOW set of the nonterminal being
+// expanded
+func LL1ParserSync(terms ...GrammarSym) LL1ParserOpt {
+	return func(p *LL1Parser) {
+		for _, i := range terms {
+			p.sync[i.kind] = struct{}{}
+		}
+	}
+}
+
+// ParseRecover parses the tokens in panic mode, returning a partial tree and
+// every error. On an unexpected token while expanding a nonterminal, tokens
+// are skipped until one which may begin the nonterminal, in which case it is
+// expanded again, or one which is in its FOLLOW set, a synchronization
+// terminal after at least one skipped token, or EOF, in which case an error
+// node replaces the nonterminal. An unexpected token in place of a terminal
+// is left unconsumed, and an error node replaces the missing terminal.
+// Skipped tokens are the children of the error node. An error is only
+// recorded if a token has been consumed since the previous error, to avoid
+// cascading errors. Errors of unexpected tokens are *ParseError. A missing
+// operand of an expression of an operator table is replaced by an error node,
+// and a non-associative operator is applied as left associative.
+func (p *LL1Parser) ParseRecover(tokens []Token) (*ParseTree, []error) {
+	errs := []error{}
+	lastErr := -1
+	report := func(err *ParseError) {
+		if err.pos == lastErr {
+			return
+		}
+		lastErr = err.pos
+		errs = append(errs, err)
+	}
+	reportExpr := func(err error) bool {
+		var perr *ParseError
+		if errors.As(err, &perr) {
+			report(perr)
+		} else {
+			errs = append(errs, err)
+		}
+		return true
+	}
+	predict := func(nt int, ts *tokenStack) ([]GrammarSym, error) {
+		next, ok := ts.Peek()
+		if !ok {
+			return nil, p.parseError(nt, ts.Pos(), Token{})
+		}
+		prod, ok := p.getProduction(nt, next.Kind())
+		if !ok {
+			return nil, p.parseError(nt, ts.Pos(), next)
+		}
+		return prod, nil
+	}
+
+	ts := newTokenStack(tokens)
+	sm := newLL1SymMatcherStack()
+	root := newParseTree(GrammarSym{})
+	sm.Push(newLL1RootMatcher(p.start, p.eof, root))
+	for !sm.Empty() {
+		m, _ := sm.Peek()
+		if m.Done() {
+			if m.expr != nil {
+				// the end of the token stream is reported by the matcher
+				// below
+				if wait, _ := m.StepExpr(ts, predict, reportExpr); wait {
+					continue
+				}
+			}
+			sm.Pop()
+			continue
+		}
+		sym, _ := m.First()
+		next, ok := ts.Peek()
+		if !ok {
+			if sym.Term() {
+				report(m.parseError(ts.Pos(), Token{}))
+			} else {
+				report(p.parseError(sym.kind, ts.Pos(), Token{}))
+			}
+			break
+		}
+		if sym.Term() {
+			if sym.kind == next.Kind() {
+				ts.Pop()
+				m.Match(newParseTreeLeaf(sym, next))
+				continue
+			}
+			report(m.parseError(ts.Pos(), next))
+			node := newParseTreeErr(sym)
+			if sym == p.eof {
+				// trailing tokens after a complete parse are skipped into an
+				// error node at the end of the start symbol
+				p.skip(ts, node, func(kind int) bool {
+					return false
+				})
+				root.children[0].addChild(node)
+				continue
+			}
+			m.Match(node)
+			continue
+		}
+		if prod, ok := p.getProduction(sym.kind, next.Kind()); ok {
+			child := newParseTree(sym)
+			m.Match(child)
+			if g, ok := p.exprs[sym.kind]; ok {
+				sm.Push(newLL1ExprMatcher(g, child))
+				continue
+			}
+			sm.Push(newLL1SymMatcher(prod, child))
+			continue
+		}
+		row := p.table[sym.kind]
+		report(p.parseError(sym.kind, ts.Pos(), next))
+		node := newParseTreeErr(sym)
+		pos := ts.Pos()
+		next, ok = p.skip(ts, node, func(kind int) bool {
+			if _, ok := row[kind]; ok {
+				return true
+			}
+			// an offending synchronization terminal is skipped, since the
+			// nonterminal is not followed by it
+			if _, ok := p.sync[kind]; ok && ts.Pos() > pos {
+				return true
+			}
+			_, ok := p.follow.iter(sym.kind)[kind]
+			return ok
+		})
+		if ok {
+			if _, ok := row[next.Kind()]; ok {
+				m.node.addChild(node)
+				continue
+			}
+		}
+		m.Match(node)
+	}
+	if len(root.children) == 0 {
+		return nil, errs
+	}
+	return root.children[0], errs
+}
+
+// skip pops tokens as children of the error node until a token for which
+// stop returns true or EOF, and returns the token at which it stopped
+func (p *LL1Parser) skip(ts *tokenStack, node *ParseTree, stop func(kind int) bool) (Token, bool) {
+	for {
+		next, ok := ts.Peek()
+		if !ok {
+			return Token{}, false
+		}
+		if next.Kind() == p.eof.kind || stop(next.Kind()) {
+			return next, true
+		}
+		ts.Pop()
+		node.addChild(newParseTreeLeaf(NewGrammarTerm(next.Kind()), next))
+	}
+}
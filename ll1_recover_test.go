@@ -0,0 +1,154 @@
+package gnom
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestLL1Parser_ParseRecover(t *testing.T) {
+	assert := assert.New(t)
+
+	g := NewGrammarSymGenerator()
+
+	S := g.NonTerm()
+	eof := g.Term()
+
+	Stmt := g.NonTerm()
+	E := g.NonTerm()
+	id := g.Term()
+	num := g.Term()
+	eq := g.Term()
+	semi := g.Term()
+
+	rules := []GrammarRule{
+		NewGrammarRule(S, Stmt, S),
+		NewGrammarRule(S),
+		NewGrammarRule(Stmt, id, eq, E, semi),
+		NewGrammarRule(E, id),
+		NewGrammarRule(E, num),
+	}
+
+	p, err := NewLL1Parser(rules, S, eof, LL1ParserSync(semi))
+	assert.NoError(err, "Should create parser")
+
+	tok := func(kind GrammarSym, val string) Token {
+		return newToken(kind.Kind(), val)
+	}
+
+	{
+		tokens := []Token{
+			tok(id, "x"), tok(eq, "="), tok(num, "1"), tok(semi, ";"),
+			tok(eof, ""),
+		}
+		tree, errs := p.ParseRecover(tokens)
+		assert.Len(errs, 0, "Should parse valid input without errors")
+		exp, err := p.Parse(tokens)
+		assert.NoError(err, "Should parse valid input")
+		assert.Equal(exp, tree, "Should produce the same tree as Parse")
+	}
+
+	type expErr struct {
+		pos      int
+		token    string
+		expected []GrammarSym
+	}
+	for n, c := range []struct {
+		tokens []Token
+		errs   []expErr
+		// errNodes are the symbols of error nodes in order with the values
+		// of their skipped tokens
+		errNodes []GrammarSym
+		skipped  [][]string
+	}{
+		{
+			tokens: []Token{
+				tok(id, "x"), tok(eq, "="), tok(eq, "="), tok(semi, ";"),
+				tok(id, "y"), tok(eq, "="), tok(num, "2"), tok(semi, ";"),
+				tok(eof, ""),
+			},
+			errs: []expErr{
+				{pos: 2, token: "=", expected: []GrammarSym{id, num}},
+			},
+			errNodes: []GrammarSym{E},
+			skipped:  [][]string{{"="}},
+		},
+		{
+			tokens: []Token{
+				tok(id, "x"), tok(num, "1"), tok(semi, ";"),
+				tok(id, "y"), tok(eq, "="), tok(semi, ";"), tok(semi, ";"),
+				tok(id, "z"), tok(eq, "="), tok(num, "3"), tok(semi, ";"),
+				tok(eof, ""),
+			},
+			errs: []expErr{
+				{pos: 1, token: "1", expected: []GrammarSym{eq}},
+				{pos: 5, token: ";", expected: []GrammarSym{id, num}},
+				{pos: 6, token: ";", expected: []GrammarSym{eof, id}},
+			},
+			errNodes: []GrammarSym{eq, E, S},
+			skipped:  [][]string{{}, {}, {";"}},
+		},
+		{
+			tokens: []Token{
+				tok(id, "x"), tok(eq, "="), tok(num, "1"), tok(semi, ";"),
+				tok(num, "2"), tok(num, "3"),
+				tok(eof, ""),
+			},
+			errs: []expErr{
+				{pos: 4, token: "2", expected: []GrammarSym{eof, id}},
+			},
+			errNodes: []GrammarSym{S},
+			skipped:  [][]string{{"2", "3"}},
+		},
+		{
+			tokens: []Token{
+				tok(id, "x"), tok(eq, "="), tok(num, "1"),
+			},
+			errs: []expErr{
+				{pos: 3, token: "", expected: []GrammarSym{semi}},
+			},
+			errNodes: []GrammarSym{},
+			skipped:  [][]string{},
+		},
+	} {
+		tree, errs := p.ParseRecover(c.tokens)
+		assert.NotNilf(tree, "Should return a partial tree: case %d", n)
+		assert.Lenf(errs, len(c.errs), "Should report every error: case %d", n)
+		for m, i := range errs {
+			if m >= len(c.errs) {
+				break
+			}
+			assert.Truef(errors.Is(i, ErrParse), "Should be a parse error: case %d %d", n, m)
+			var perr *ParseError
+			if !assert.Truef(errors.As(i, &perr), "Should be a *ParseError: case %d %d", n, m) {
+				continue
+			}
+			assert.Equalf(c.errs[m].pos, perr.Pos(), "Invalid error position: case %d %d", n, m)
+			token := perr.Token()
+			assert.Equalf(c.errs[m].token, token.Val(), "Invalid error token: case %d %d", n, m)
+			assert.Equalf(c.errs[m].expected, perr.Expected(), "Invalid expected terminals: case %d %d", n, m)
+		}
+
+		errNodes := []GrammarSym{}
+		skipped := [][]string{}
+		stack := []*ParseTree{tree}
+		for len(stack) > 0 {
+			k := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if k.Err() {
+				errNodes = append(errNodes, k.Sym())
+				vals := []string{}
+				for _, i := range k.Children() {
+					vals = append(vals, i.Val())
+				}
+				skipped = append(skipped, vals)
+				continue
+			}
+			for i := len(k.Children()) - 1; i >= 0; i-- {
+				stack = append(stack, k.Children()[i])
+			}
+		}
+		assert.Equalf(c.errNodes, errNodes, "Invalid error nodes: case %d", n)
+		assert.Equalf(c.skipped, skipped, "Invalid skipped tokens: case %d", n)
+	}
+}
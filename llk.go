@@ -0,0 +1,360 @@
+package gnom
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type (
+	llkSet struct {
+		change bool
+		set    map[string][]int
+	}
+
+	LLkConflict struct {
+		nonTerm   GrammarSym
+		lookahead []GrammarSym
+		rules     [2]int
+	}
+
+	LLkConflictError struct {
+		k         int
+		conflicts []LLkConflict
+	}
+
+	LLkParser struct {
+		k          int
+		table      map[int]map[string][]GrammarSym
+		lookaheads map[int][][]int
+		start      GrammarSym
+		eof        GrammarSym
+	}
+)
+
+func intsKey(s []int) string {
+	b := strings.Builder{}
+	for _, i := range s {
+		b.WriteString(strconv.Itoa(i))
+		b.WriteByte(',')
+	}
+	return b.String()
+}
+
+func newLLkSet() *llkSet {
+	return &llkSet{
+		change: false,
+		set:    map[string][]int{},
+	}
+}
+
+func (s *llkSet) resetChanged() {
+	s.change = false
+}
+
+func (s *llkSet) upsert(w []int) {
+	k := intsKey(w)
+	if _, ok := s.set[k]; !ok {
+		s.change = true
+		s.set[k] = w
+	}
+}
+
+func (s *llkSet) upsertAll(m map[string][]int) {
+	for _, v := range m {
+		s.upsert(v)
+	}
+}
+
+func sortedLLkKeys(m map[string][]int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// llkConcat returns the prefixes of length at most k of the concatenations of
+// strings in a and b
+func llkConcat(a, b map[string][]int, k int) map[string][]int {
+	res := map[string][]int{}
+	for _, i := range a {
+		if len(i) >= k {
+			res[intsKey(i)] = i
+			continue
+		}
+		for _, j := range b {
+			w := make([]int, 0, k)
+			w = append(w, i...)
+			for _, t := range j {
+				if len(w) >= k {
+					break
+				}
+				w = append(w, t)
+			}
+			res[intsKey(w)] = w
+		}
+	}
+	return res
+}
+
+func calcLLkFirst(syms []GrammarSym, firstSets map[int]*llkSet, k int) map[string][]int {
+	res := map[string][]int{
+		"": {},
+	}
+	for _, i := range syms {
+		done := true
+		for _, w := range res {
+			if len(w) < k {
+				done = false
+				break
+			}
+		}
+		if done {
+			return res
+		}
+		if i.term {
+			res = llkConcat(res, map[string][]int{
+				intsKey([]int{i.kind}): {i.kind},
+			}, k)
+			continue
+		}
+		s, ok := firstSets[i.kind]
+		if !ok {
+			return map[string][]int{}
+		}
+		res = llkConcat(res, s.set, k)
+	}
+	return res
+}
+
+// calcLLkFirstSets returns for each nonterminal the prefixes of length k of
+// the strings it derives, and the strings shorter than k it derives
+func calcLLkFirstSets(rules []GrammarRule, k int) map[int]*llkSet {
+	sets := map[int]*llkSet{}
+	for _, i := range rules {
+		if _, ok := sets[i.from]; !ok {
+			sets[i.from] = newLLkSet()
+		}
+	}
+	for {
+		changed := false
+		for _, i := range rules {
+			s := sets[i.from]
+			s.resetChanged()
+			s.upsertAll(calcLLkFirst(i.to, sets, k))
+			if s.change {
+				changed = true
+			}
+		}
+		if !changed {
+			return sets
+		}
+	}
+}
+
+// calcLLkFollowSets returns for each nonterminal the strings of length k that
+// may follow it, where the input is padded with eof
+func calcLLkFollowSets(rules []GrammarRule, start, eof int, k int, firstSets map[int]*llkSet) map[int]*llkSet {
+	sets := map[int]*llkSet{}
+	for _, i := range rules {
+		if _, ok := sets[i.from]; !ok {
+			sets[i.from] = newLLkSet()
+		}
+	}
+	end := make([]int, k)
+	for n := range end {
+		end[n] = eof
+	}
+	sets[start].upsert(end)
+	for {
+		changed := false
+		for _, i := range rules {
+			for n, j := range i.to {
+				if j.term {
+					continue
+				}
+				s := sets[j.kind]
+				s.resetChanged()
+				s.upsertAll(llkConcat(calcLLkFirst(i.to[n+1:], firstSets, k), sets[i.from].set, k))
+				if s.change {
+					changed = true
+				}
+			}
+		}
+		if !changed {
+			return sets
+		}
+	}
+}
+
+func (c *LLkConflict) NonTerm() GrammarSym {
+	return c.nonTerm
+}
+
+func (c *LLkConflict) Lookahead() []GrammarSym {
+	return c.lookahead
+}
+
+// Rules returns the indices of the competing rules
+func (c *LLkConflict) Rules() [2]int {
+	return c.rules
+}
+
+func (c *LLkConflict) String() string {
+	s := strings.Builder{}
+	fmt.Fprintf(&s, "Conflict for %s on", c.nonTerm)
+	for _, i := range c.lookahead {
+		s.WriteString(" ")
+		s.WriteString(i.String())
+	}
+	fmt.Fprintf(&s, ": rules %d, %d", c.rules[0], c.rules[1])
+	return s.String()
+}
+
+func (e *LLkConflictError) Conflicts() []LLkConflict {
+	return e.conflicts
+}
+
+func (e *LLkConflictError) Error() string {
+	s := strings.Builder{}
+	fmt.Fprintf(&s, "Grammar is not LL(%d)", e.k)
+	for _, i := range e.conflicts {
+		s.WriteString(": ")
+		s.WriteString(i.String())
+	}
+	s.WriteString(": ")
+	s.WriteString(ErrGrammar.Error())
+	return s.String()
+}
+
+func (e *LLkConflictError) Unwrap() error {
+	return ErrGrammar
+}
+
+// NewLLkParser creates a strong LL(k) parser, which chooses the production of
+// a nonterminal by the next k tokens
+func NewLLkParser(rules []GrammarRule, start, eof GrammarSym, k int) (*LLkParser, error) {
+	if k < 1 {
+		return nil, fmt.Errorf("Invalid lookahead: %d: %w", k, ErrGrammar)
+	}
+	if err := checkGrammarErr(CheckGrammar(rules, start, eof)); err != nil {
+		return nil, err
+	}
+	firstSets := calcLLkFirstSets(rules, k)
+	followSets := calcLLkFollowSets(rules, start.Kind(), eof.Kind(), k, firstSets)
+
+	table := map[int]map[string][]GrammarSym{}
+	tableLookaheads := map[int][][]int{}
+	entries := map[int]map[string]int{}
+	conflicts := []LLkConflict{}
+	for n, i := range rules {
+		if _, ok := table[i.from]; !ok {
+			table[i.from] = map[string][]GrammarSym{}
+			entries[i.from] = map[string]int{}
+		}
+		lookaheads := llkConcat(calcLLkFirst(i.to, firstSets, k), followSets[i.from].set, k)
+		for _, key := range sortedLLkKeys(lookaheads) {
+			prev, ok := entries[i.from][key]
+			if !ok {
+				entries[i.from][key] = n
+				table[i.from][key] = i.to
+				tableLookaheads[i.from] = append(tableLookaheads[i.from], lookaheads[key])
+				continue
+			}
+			if prev == n {
+				continue
+			}
+			lookahead := make([]GrammarSym, 0, k)
+			for _, t := range lookaheads[key] {
+				lookahead = append(lookahead, NewGrammarTerm(t))
+			}
+			conflicts = append(conflicts, LLkConflict{
+				nonTerm:   NewGrammarNonTerm(i.from),
+				lookahead: lookahead,
+				rules:     [2]int{prev, n},
+			})
+		}
+	}
+	if len(conflicts) > 0 {
+		return nil, &LLkConflictError{
+			k:         k,
+			conflicts: conflicts,
+		}
+	}
+
+	return &LLkParser{
+		k:          k,
+		table:      table,
+		lookaheads: tableLookaheads,
+		start:      start,
+		eof:        eof,
+	}, nil
+}
+
+func NewLLkParserFromGrammar(g *Grammar, k int) (*LLkParser, error) {
+	return NewLLkParser(g.rules, g.start, g.eof, k)
+}
+
+// Parse parses the tokens. If a token is unexpected, the error is a
+// *ParseError at the first of the lookahead tokens that no lookahead of the
+// nonterminal being expanded continues with.
+func (p *LLkParser) Parse(tokens []Token) (*ParseTree, error) {
+	return parseLL(tokens, p.start, p.eof, nil, func(nt int, ts *tokenStack) ([]GrammarSym, error) {
+		next := ts.PeekN(p.k)
+		if len(next) == 0 {
+			return nil, fmt.Errorf("Unexpected end of token stream: %w", ErrParse)
+		}
+		lookahead := make([]int, 0, p.k)
+		for _, i := range next {
+			lookahead = append(lookahead, i.Kind())
+		}
+		for len(lookahead) < p.k {
+			lookahead = append(lookahead, p.eof.Kind())
+		}
+		prod, ok := p.table[nt][intsKey(lookahead)]
+		if !ok {
+			return nil, p.parseError(nt, ts.Pos(), lookahead, next)
+		}
+		return prod, nil
+	})
+}
+
+// parseError returns an error at the first of the next tokens with which no
+// lookahead of the nonterminal continues, which expects the terminals with
+// which the lookaheads matching the preceding tokens continue
+func (p *LLkParser) parseError(nt int, pos int, lookahead []int, next []Token) *ParseError {
+	rows := p.lookaheads[nt]
+	n := 0
+	for ; n < len(lookahead); n++ {
+		matched := [][]int{}
+		for _, i := range rows {
+			if i[n] == lookahead[n] {
+				matched = append(matched, i)
+			}
+		}
+		if len(matched) == 0 {
+			break
+		}
+		rows = matched
+	}
+	expected := map[int]struct{}{}
+	for _, i := range rows {
+		if n < len(i) {
+			expected[i[n]] = struct{}{}
+		}
+	}
+	var token Token
+	if n < len(next) {
+		token = next[n]
+	}
+	sym := NewGrammarNonTerm(nt)
+	return &ParseError{
+		pos:      pos + n,
+		token:    token,
+		nonTerm:  &sym,
+		expected: symsFromSet(expected, true),
+	}
+}
@@ -0,0 +1,148 @@
+package gnom
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestLLkParser_Parse(t *testing.T) {
+	assert := assert.New(t)
+
+	g := NewGrammarSymGenerator()
+
+	S := g.NonTerm()
+	eof := g.Term()
+
+	A := g.NonTerm()
+	L := g.NonTerm()
+	id := g.Term()
+	eq := g.Term()
+	lparen := g.Term()
+	rparen := g.Term()
+	semi := g.Term()
+
+	rules := []GrammarRule{
+		NewGrammarRule(S, A, semi, S),
+		NewGrammarRule(S),
+		NewGrammarRule(A, id, eq, id),
+		NewGrammarRule(A, id, lparen, L, rparen),
+		NewGrammarRule(L, id),
+		NewGrammarRule(L),
+	}
+
+	_, err := NewLL1Parser(rules, S, eof)
+	assert.Error(err, "Grammar should not be LL1")
+	{
+		_, err := NewLLkParser(rules, S, eof, 1)
+		assert.Error(err, "Grammar should not be LL(1)")
+		assert.True(errors.Is(err, ErrGrammar), "Conflict should be a grammar error")
+		var cerr *LLkConflictError
+		assert.True(errors.As(err, &cerr), "Error should be a conflict error")
+		assert.Equal([]LLkConflict{
+			{
+				nonTerm:   A,
+				lookahead: []GrammarSym{id},
+				rules:     [2]int{2, 3},
+			},
+		}, cerr.Conflicts())
+		assert.Equal("Grammar is not LL(1): Conflict for n2 on t4: rules 2, 3: grammar error", err.Error())
+	}
+	{
+		_, err := NewLLkParser(rules, S, eof, 0)
+		assert.True(errors.Is(err, ErrGrammar), "Lookahead must be positive")
+	}
+
+	parser, err := NewLLkParser(rules, S, eof, 2)
+	assert.NoErrorf(err, "Failed to create parser: %v", err)
+
+	for n, c := range []struct {
+		tokens   []Token
+		exp      string
+		err      error
+		pos      int
+		expected []GrammarSym
+	}{
+		{
+			tokens: []Token{
+				newToken(id.Kind(), "a"),
+				newToken(eq.Kind(), "="),
+				newToken(id.Kind(), "b"),
+				newToken(semi.Kind(), ";"),
+				newToken(id.Kind(), "f"),
+				newToken(lparen.Kind(), "("),
+				newToken(rparen.Kind(), ")"),
+				newToken(semi.Kind(), ";"),
+				newToken(id.Kind(), "g"),
+				newToken(lparen.Kind(), "("),
+				newToken(id.Kind(), "x"),
+				newToken(rparen.Kind(), ")"),
+				newToken(semi.Kind(), ";"),
+				newToken(eof.Kind(), ""),
+			},
+			exp: "0(2(a = b) ; 0(2(f ( 3() )) ; 0(2(g ( 3(x) )) ; 0())))",
+		},
+		{
+			tokens: []Token{
+				newToken(eof.Kind(), ""),
+			},
+			exp: "0()",
+		},
+		{
+			tokens: []Token{
+				newToken(id.Kind(), "a"),
+				newToken(semi.Kind(), ";"),
+				newToken(eof.Kind(), ""),
+			},
+			err:      ErrParse,
+			pos:      1,
+			expected: []GrammarSym{eq, lparen},
+		},
+		{
+			tokens: []Token{
+				newToken(id.Kind(), "a"),
+				newToken(eq.Kind(), "="),
+			},
+			err: ErrParse,
+		},
+	} {
+		tree, err := parser.Parse(c.tokens)
+		if c.err != nil {
+			assert.Errorf(err, "Should fail to parse: case %d", n)
+			assert.Truef(errors.Is(err, c.err), "Should fail to parse: case %d", n)
+			var perr *ParseError
+			if c.expected != nil && assert.Truef(errors.As(err, &perr), "Should report expected terminals: case %d", n) {
+				assert.Equalf(c.pos, perr.Pos(), "Fail case %d", n)
+				assert.Equalf(c.tokens[c.pos], perr.Token(), "Fail case %d", n)
+				nonTerm, ok := perr.NonTerm()
+				assert.Truef(ok, "Fail case %d", n)
+				assert.Equalf(S, nonTerm, "Fail case %d", n)
+				assert.Equalf(c.expected, perr.Expected(), "Fail case %d", n)
+			}
+			continue
+		}
+		assert.NoErrorf(err, "Failed to parse: case %d, %v", n, err)
+		assert.Equalf(c.exp, parseTreeString(tree), "Fail case %d", n)
+	}
+
+	{
+		// k = 1 agrees with the LL1 parser on an LL1 grammar
+		tf := LeftFactor(rules, S)
+		ll1, err := NewLL1Parser(tf.Rules(), tf.Start(), eof)
+		assert.NoError(err, "Factored grammar should be LL1")
+		llk, err := NewLLkParser(tf.Rules(), tf.Start(), eof, 1)
+		assert.NoError(err, "Factored grammar should be LL(1)")
+		tokens := []Token{
+			newToken(id.Kind(), "a"),
+			newToken(eq.Kind(), "="),
+			newToken(id.Kind(), "b"),
+			newToken(semi.Kind(), ";"),
+			newToken(eof.Kind(), ""),
+		}
+		exp, err := ll1.Parse(tokens)
+		assert.NoError(err, "Failed to parse")
+		tree, err := llk.Parse(tokens)
+		assert.NoError(err, "Failed to parse")
+		assert.Equal(parseTreeString(exp), parseTreeString(tree))
+	}
+}
@@ -0,0 +1,1126 @@
+package gnom
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type (
+	LRMode int
+
+	LRActionKind int
+
+	LRAction struct {
+		kind   LRActionKind
+		target int
+	}
+
+	LRItem struct {
+		rule int
+		dot  int
+	}
+
+	LRConflict struct {
+		state     int
+		lookahead GrammarSym
+		actions   []LRAction
+		items     []LRItem
+		rules     []GrammarRule
+		resolved  bool
+		kept      []LRAction
+	}
+
+	LRConflictError struct {
+		mode      LRMode
+		conflicts []LRConflict
+		resolved  []LRConflict
+	}
+
+	// LRPrecedence holds yacc style precedence and associativity
+	// declarations of terminals, which resolve shift reduce conflicts. In a
+	// conflict of a shift and several reduces, the shift is resolved against
+	// each reduce, and a reduce reduce conflict among the kept reduces is
+	// reported as a conflict of its own.
+	LRPrecedence struct {
+		terms  map[int]lrPrecLevel
+		levels int
+	}
+
+	lrPrecLevel struct {
+		level int
+		assoc OpAssoc
+	}
+
+	lrState struct {
+		items []LRItem
+		// lookaheads holds the lookahead set of each item, and is nil when
+		// reductions are decided by FOLLOW sets
+		lookaheads []map[int]struct{}
+		kernel     int
+		gotos      map[GrammarSym]int
+	}
+
+	lrTable struct {
+		rules     []GrammarRule
+		actions   []map[int][]LRAction
+		gotos     []map[int]int
+		conflicts []LRConflict
+		resolved  []LRConflict
+		// nonTerms holds the nonterminal of the kernel items of each state,
+		// and is nil for states whose kernel items differ in nonterminal
+		nonTerms []*GrammarSym
+	}
+
+	lrBuilder struct {
+		rules     []GrammarRule
+		ruleMap   map[int][]int
+		start     int
+		eof       int
+		augmented int
+		nullable  *changeIntSet
+		first     *changeIntIntSet
+		prec      *LRPrecedence
+	}
+
+	LRParser struct {
+		table *lrTable
+		start GrammarSym
+		eof   GrammarSym
+		prec  *LRPrecedence
+	}
+
+	LRParserOpt func(p *LRParser)
+)
+
+const (
+	// LRModeSLR reduces on the FOLLOW set of the nonterminal of a rule
+	LRModeSLR LRMode = iota
+	// LRModeLALR merges all LR(1) states with the same LR(0) items
+	LRModeLALR
+	// LRModeCanonical builds the full LR(1) automaton
+	LRModeCanonical
+	// LRModeMinimal merges LR(1) states with the same LR(0) items only when
+	// merging introduces no conflicts
+	LRModeMinimal
+)
+
+const (
+	LRActionShift LRActionKind = iota
+	LRActionReduce
+	LRActionAccept
+)
+
+const (
+	// lrPropagate is the placeholder lookahead used to find which lookaheads
+	// propagate between LALR kernel items
+	lrPropagate = -1
+)
+
+func (m LRMode) String() string {
+	switch m {
+	case LRModeSLR:
+		return "SLR(1)"
+	case LRModeLALR:
+		return "LALR(1)"
+	case LRModeCanonical:
+		return "LR(1)"
+	case LRModeMinimal:
+		return "minimal LR(1)"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+func (a *LRAction) Kind() LRActionKind {
+	return a.kind
+}
+
+// Target returns the state to shift to, or the index of the rule to reduce
+func (a *LRAction) Target() int {
+	return a.target
+}
+
+func (a LRAction) String() string {
+	switch a.kind {
+	case LRActionShift:
+		return "shift " + strconv.Itoa(a.target)
+	case LRActionReduce:
+		return "reduce " + strconv.Itoa(a.target)
+	case LRActionAccept:
+		return "accept"
+	default:
+		return "unknown"
+	}
+}
+
+// Rule returns the index of the rule of the item. The augmented start rule
+// has the index one past the last grammar rule.
+func (i *LRItem) Rule() int {
+	return i.rule
+}
+
+// Dot returns the number of symbols of the rule preceding the dot
+func (i *LRItem) Dot() int {
+	return i.dot
+}
+
+func (i LRItem) format(rules []GrammarRule) string {
+	r := rules[i.rule]
+	s := strings.Builder{}
+	s.WriteString(r.From().String())
+	s.WriteString(" ->")
+	for n, j := range r.to {
+		if n == i.dot {
+			s.WriteString(" .")
+		}
+		s.WriteString(" ")
+		s.WriteString(j.String())
+	}
+	if i.dot == len(r.to) {
+		s.WriteString(" .")
+	}
+	return s.String()
+}
+
+func (c *LRConflict) State() int {
+	return c.state
+}
+
+func (c *LRConflict) Lookahead() GrammarSym {
+	return c.lookahead
+}
+
+func (c *LRConflict) Actions() []LRAction {
+	return c.actions
+}
+
+// Items returns the items of the state which produce the conflicting actions
+func (c *LRConflict) Items() []LRItem {
+	return c.items
+}
+
+// Resolved returns true if the conflict was resolved by precedence
+func (c *LRConflict) Resolved() bool {
+	return c.resolved
+}
+
+// Resolution returns the actions kept of a conflict resolved by precedence,
+// which are none if the lookahead is an error, and more than one if a reduce
+// reduce conflict remains
+func (c *LRConflict) Resolution() []LRAction {
+	return c.kept
+}
+
+func (c *LRConflict) String() string {
+	s := strings.Builder{}
+	fmt.Fprintf(&s, "Conflict in state %d on %s: ", c.state, c.lookahead)
+	for n, i := range c.actions {
+		if n > 0 {
+			s.WriteString(", ")
+		}
+		s.WriteString(i.String())
+	}
+	s.WriteString(" (")
+	for n, i := range c.items {
+		if n > 0 {
+			s.WriteString("; ")
+		}
+		s.WriteString(i.format(c.rules))
+	}
+	s.WriteString(")")
+	if c.resolved {
+		s.WriteString(": resolved as ")
+		if len(c.kept) == 0 {
+			s.WriteString("error")
+		}
+		for n, i := range c.kept {
+			if n > 0 {
+				s.WriteString(", ")
+			}
+			s.WriteString(i.String())
+		}
+	}
+	return s.String()
+}
+
+func (e *LRConflictError) Conflicts() []LRConflict {
+	return e.conflicts
+}
+
+// Resolved returns the conflicts which were resolved by precedence
+func (e *LRConflictError) Resolved() []LRConflict {
+	return e.resolved
+}
+
+func (e *LRConflictError) Error() string {
+	s := strings.Builder{}
+	fmt.Fprintf(&s, "Grammar is not %s", e.mode)
+	for _, i := range e.conflicts {
+		s.WriteString(": ")
+		s.WriteString(i.String())
+	}
+	s.WriteString(": ")
+	s.WriteString(ErrGrammar.Error())
+	return s.String()
+}
+
+func (e *LRConflictError) Unwrap() error {
+	return ErrGrammar
+}
+
+func NewLRPrecedence() *LRPrecedence {
+	return &LRPrecedence{
+		terms:  map[int]lrPrecLevel{},
+		levels: 0,
+	}
+}
+
+func (p *LRPrecedence) declare(assoc OpAssoc, terms []GrammarSym) *LRPrecedence {
+	p.levels++
+	for _, i := range terms {
+		p.terms[i.kind] = lrPrecLevel{
+			level: p.levels,
+			assoc: assoc,
+		}
+	}
+	return p
+}
+
+// Left declares the terminals left associative like %left, with a higher
+// precedence than the terminals of every previous declaration
+func (p *LRPrecedence) Left(terms ...GrammarSym) *LRPrecedence {
+	return p.declare(OpAssocLeft, terms)
+}
+
+// Right declares the terminals right associative like %right, with a higher
+// precedence than the terminals of every previous declaration
+func (p *LRPrecedence) Right(terms ...GrammarSym) *LRPrecedence {
+	return p.declare(OpAssocRight, terms)
+}
+
+// NonAssoc declares the terminals non associative like %nonassoc, with a
+// higher precedence than the terminals of every previous declaration
+func (p *LRPrecedence) NonAssoc(terms ...GrammarSym) *LRPrecedence {
+	return p.declare(OpAssocNone, terms)
+}
+
+// rule returns the precedence of a rule, which is the precedence given by
+// WithPrec, or else the precedence of its last terminal
+func (p *LRPrecedence) rule(r GrammarRule) (lrPrecLevel, bool) {
+	if term, ok := r.Prec(); ok {
+		l, ok := p.terms[term.kind]
+		return l, ok
+	}
+	for n := len(r.to) - 1; n >= 0; n-- {
+		if r.to[n].term {
+			l, ok := p.terms[r.to[n].kind]
+			return l, ok
+		}
+	}
+	return lrPrecLevel{}, false
+}
+
+// resolve returns the actions kept of a conflict on the lookahead, where the
+// shift is resolved against each reduce by precedence, or false if
+// precedence decides none of them. A reduce which wins against the shift or
+// whose rule has no precedence is kept, so a reduce reduce conflict among
+// them remains.
+func (p *LRPrecedence) resolve(rules []GrammarRule, lookahead int, actions []LRAction) ([]LRAction, bool) {
+	if p == nil {
+		return nil, false
+	}
+	shift := false
+	for _, i := range actions {
+		if i.kind == LRActionShift {
+			shift = true
+			break
+		}
+	}
+	if !shift {
+		return nil, false
+	}
+	tl, ok := p.terms[lookahead]
+	if !ok {
+		return nil, false
+	}
+	decided := false
+	keepShift := true
+	dropped := map[int]struct{}{}
+	for n, i := range actions {
+		if i.kind != LRActionReduce {
+			continue
+		}
+		rl, ok := p.rule(rules[i.target])
+		if !ok {
+			continue
+		}
+		decided = true
+		switch {
+		case rl.level > tl.level:
+			keepShift = false
+		case rl.level < tl.level:
+			dropped[n] = struct{}{}
+		case tl.assoc == OpAssocLeft:
+			keepShift = false
+		case tl.assoc == OpAssocRight:
+			dropped[n] = struct{}{}
+		default:
+			keepShift = false
+			dropped[n] = struct{}{}
+		}
+	}
+	if !decided {
+		return nil, false
+	}
+	kept := []LRAction{}
+	for n, i := range actions {
+		if i.kind == LRActionShift && !keepShift {
+			continue
+		}
+		if _, ok := dropped[n]; ok {
+			continue
+		}
+		kept = append(kept, i)
+	}
+	return kept, true
+}
+
+func lrItemsKey(items []LRItem) string {
+	s := strings.Builder{}
+	for _, i := range items {
+		s.WriteString(strconv.Itoa(i.rule))
+		s.WriteByte('.')
+		s.WriteString(strconv.Itoa(i.dot))
+		s.WriteByte(',')
+	}
+	return s.String()
+}
+
+// newLRBuilder augments the grammar with a rule deriving the start symbol
+// from a new nonterminal
+func newLRBuilder(rules []GrammarRule, start, eof GrammarSym) *lrBuilder {
+	g := newGrammarSymGeneratorAfter(rules, start, eof)
+	augmented := make([]GrammarRule, 0, len(rules)+1)
+	augmented = append(augmented, rules...)
+	augmented = append(augmented, NewGrammarRule(g.NonTerm(), start))
+	ruleMap := map[int][]int{}
+	for n, i := range augmented {
+		ruleMap[i.from] = append(ruleMap[i.from], n)
+	}
+	nullable := calcLL1NullableSet(augmented)
+	return &lrBuilder{
+		rules:     augmented,
+		ruleMap:   ruleMap,
+		start:     start.Kind(),
+		eof:       eof.Kind(),
+		augmented: len(rules),
+		nullable:  nullable,
+		first:     calcLL1FirstSet(augmented, nullable),
+	}
+}
+
+// next returns the symbol following the dot of an item
+func (b *lrBuilder) next(i LRItem) (GrammarSym, bool) {
+	r := b.rules[i.rule]
+	if i.dot >= len(r.to) {
+		return GrammarSym{}, false
+	}
+	return r.to[i.dot], true
+}
+
+// closure returns the closure of the kernel items, with the kernel items
+// first. When lookaheads are given, the lookahead sets of the closure items
+// are computed as well.
+func (b *lrBuilder) closure(kernel []LRItem, lookaheads []map[int]struct{}) ([]LRItem, []map[int]struct{}) {
+	items := make([]LRItem, 0, len(kernel))
+	items = append(items, kernel...)
+	index := map[LRItem]int{}
+	for n, i := range kernel {
+		index[i] = n
+	}
+	var sets []map[int]struct{}
+	if lookaheads != nil {
+		sets = make([]map[int]struct{}, 0, len(kernel))
+		for _, i := range lookaheads {
+			set := map[int]struct{}{}
+			for k := range i {
+				set[k] = struct{}{}
+			}
+			sets = append(sets, set)
+		}
+	}
+	for changed := true; changed; {
+		changed = false
+		for n := 0; n < len(items); n++ {
+			sym, ok := b.next(items[n])
+			if !ok || sym.term {
+				continue
+			}
+			var la map[int]struct{}
+			if sets != nil {
+				rest := b.rules[items[n].rule].to[items[n].dot+1:]
+				la = calcLL1First(rest, b.first, b.nullable)
+				if isLL1Nullable(rest, b.nullable) {
+					for k := range sets[n] {
+						la[k] = struct{}{}
+					}
+				}
+			}
+			for _, r := range b.ruleMap[sym.kind] {
+				item := LRItem{
+					rule: r,
+					dot:  0,
+				}
+				m, ok := index[item]
+				if !ok {
+					m = len(items)
+					index[item] = m
+					items = append(items, item)
+					if sets != nil {
+						sets = append(sets, map[int]struct{}{})
+					}
+					changed = true
+				}
+				if sets == nil {
+					continue
+				}
+				for k := range la {
+					if _, ok := sets[m][k]; !ok {
+						sets[m][k] = struct{}{}
+						changed = true
+					}
+				}
+			}
+		}
+	}
+	return items, sets
+}
+
+type (
+	lrKernel struct {
+		items      []LRItem
+		lookaheads []map[int]struct{}
+	}
+)
+
+func (k *lrKernel) Len() int {
+	return len(k.items)
+}
+
+func (k *lrKernel) Less(i, j int) bool {
+	a, b := k.items[i], k.items[j]
+	if a.rule != b.rule {
+		return a.rule < b.rule
+	}
+	return a.dot < b.dot
+}
+
+func (k *lrKernel) Swap(i, j int) {
+	k.items[i], k.items[j] = k.items[j], k.items[i]
+	if k.lookaheads != nil {
+		k.lookaheads[i], k.lookaheads[j] = k.lookaheads[j], k.lookaheads[i]
+	}
+}
+
+// key identifies the kernel by its items and, when present, their lookaheads
+func (k *lrKernel) key() string {
+	if k.lookaheads == nil {
+		return lrItemsKey(k.items)
+	}
+	s := strings.Builder{}
+	for n := range k.items {
+		s.WriteString(lrItemsKey(k.items[n : n+1]))
+		for _, j := range sortedIntSet(k.lookaheads[n]) {
+			s.WriteString(strconv.Itoa(j))
+			s.WriteByte(' ')
+		}
+		s.WriteByte(';')
+	}
+	return s.String()
+}
+
+// transitions returns the symbols following the dot in the order they first
+// appear in items, and the sorted kernel reached by each
+func (b *lrBuilder) transitions(items []LRItem, lookaheads []map[int]struct{}) ([]GrammarSym, map[GrammarSym]*lrKernel) {
+	syms := []GrammarSym{}
+	kernels := map[GrammarSym]*lrKernel{}
+	for n, i := range items {
+		sym, ok := b.next(i)
+		if !ok {
+			continue
+		}
+		k, ok := kernels[sym]
+		if !ok {
+			syms = append(syms, sym)
+			k = &lrKernel{}
+			if lookaheads != nil {
+				k.lookaheads = []map[int]struct{}{}
+			}
+			kernels[sym] = k
+		}
+		k.items = append(k.items, LRItem{
+			rule: i.rule,
+			dot:  i.dot + 1,
+		})
+		if lookaheads != nil {
+			k.lookaheads = append(k.lookaheads, lookaheads[n])
+		}
+	}
+	for _, k := range kernels {
+		sort.Sort(k)
+	}
+	return syms, kernels
+}
+
+// states builds the LR(0) automaton, or the canonical LR(1) automaton when
+// lr1 is set
+func (b *lrBuilder) states(lr1 bool) []*lrState {
+	states := []*lrState{}
+	index := map[string]int{}
+	add := func(kernel *lrKernel) int {
+		key := kernel.key()
+		if n, ok := index[key]; ok {
+			return n
+		}
+		items, sets := b.closure(kernel.items, kernel.lookaheads)
+		n := len(states)
+		index[key] = n
+		states = append(states, &lrState{
+			items:      items,
+			lookaheads: sets,
+			kernel:     len(kernel.items),
+			gotos:      map[GrammarSym]int{},
+		})
+		return n
+	}
+	initial := &lrKernel{
+		items: []LRItem{{
+			rule: b.augmented,
+			dot:  0,
+		}},
+	}
+	if lr1 {
+		initial.lookaheads = []map[int]struct{}{{b.eof: {}}}
+	}
+	add(initial)
+	for n := 0; n < len(states); n++ {
+		s := states[n]
+		syms, kernels := b.transitions(s.items, s.lookaheads)
+		for _, i := range syms {
+			s.gotos[i] = add(kernels[i])
+		}
+	}
+	return states
+}
+
+// conflictTerms returns the lookaheads on which the items of a state produce
+// more than one action
+func (b *lrBuilder) conflictTerms(items []LRItem, lookaheads []map[int]struct{}) map[int]struct{} {
+	shifts := map[int]struct{}{}
+	reduces := map[int]map[int]struct{}{}
+	for n, i := range items {
+		sym, ok := b.next(i)
+		if ok {
+			if sym.term {
+				shifts[sym.kind] = struct{}{}
+			}
+			continue
+		}
+		if i.rule == b.augmented {
+			shifts[b.eof] = struct{}{}
+			continue
+		}
+		for k := range lookaheads[n] {
+			if _, ok := reduces[k]; !ok {
+				reduces[k] = map[int]struct{}{}
+			}
+			reduces[k][i.rule] = struct{}{}
+		}
+	}
+	terms := map[int]struct{}{}
+	for k, v := range reduces {
+		count := len(v)
+		if _, ok := shifts[k]; ok {
+			count++
+		}
+		if count > 1 {
+			terms[k] = struct{}{}
+		}
+	}
+	return terms
+}
+
+func unionLookaheads(a, b []map[int]struct{}) []map[int]struct{} {
+	sets := make([]map[int]struct{}, 0, len(a))
+	for n, i := range a {
+		set := map[int]struct{}{}
+		for k := range i {
+			set[k] = struct{}{}
+		}
+		for k := range b[n] {
+			set[k] = struct{}{}
+		}
+		sets = append(sets, set)
+	}
+	return sets
+}
+
+// mergeStates merges canonical LR(1) states with identical LR(0) cores as
+// long as doing so introduces no conflicts, and the merged states agree on
+// the merged states they go to
+func (b *lrBuilder) mergeStates(states []*lrState) []*lrState {
+	// group states of the same core into clusters without new conflicts
+	type cluster struct {
+		lookaheads []map[int]struct{}
+		conflicts  map[int]struct{}
+	}
+	part := make([]int, len(states))
+	clusters := []*cluster{}
+	cores := map[string][]int{}
+	for n, s := range states {
+		core := lrItemsKey(s.items[:s.kernel])
+		conflicts := b.conflictTerms(s.items, s.lookaheads)
+		found := false
+		for _, c := range cores[core] {
+			cl := clusters[c]
+			merged := unionLookaheads(cl.lookaheads, s.lookaheads)
+			ok := true
+			for k := range b.conflictTerms(s.items, merged) {
+				_, inCluster := cl.conflicts[k]
+				_, inState := conflicts[k]
+				if !inCluster && !inState {
+					ok = false
+					break
+				}
+			}
+			if !ok {
+				continue
+			}
+			cl.lookaheads = merged
+			for k := range conflicts {
+				cl.conflicts[k] = struct{}{}
+			}
+			part[n] = c
+			found = true
+			break
+		}
+		if found {
+			continue
+		}
+		part[n] = len(clusters)
+		cores[core] = append(cores[core], len(clusters))
+		clusters = append(clusters, &cluster{
+			lookaheads: s.lookaheads,
+			conflicts:  conflicts,
+		})
+	}
+
+	// split clusters whose states go to different clusters, which only
+	// removes merges and so never introduces conflicts
+	size := len(clusters)
+	for {
+		next := make([]int, len(states))
+		index := map[string]int{}
+		for n, s := range states {
+			k := strings.Builder{}
+			k.WriteString(strconv.Itoa(part[n]))
+			syms, _ := b.transitions(s.items, nil)
+			for _, i := range syms {
+				fmt.Fprintf(&k, ",%s:%d", i, part[s.gotos[i]])
+			}
+			key := k.String()
+			m, ok := index[key]
+			if !ok {
+				m = len(index)
+				index[key] = m
+			}
+			next[n] = m
+		}
+		count := len(index)
+		part = next
+		if count == size {
+			break
+		}
+		size = count
+	}
+
+	merged := make([]*lrState, 0, size)
+	for n, s := range states {
+		m := part[n]
+		if m == len(merged) {
+			merged = append(merged, &lrState{
+				items:      s.items,
+				lookaheads: s.lookaheads,
+				kernel:     s.kernel,
+				gotos:      map[GrammarSym]int{},
+			})
+			for k, v := range s.gotos {
+				merged[m].gotos[k] = part[v]
+			}
+			continue
+		}
+		merged[m].lookaheads = unionLookaheads(merged[m].lookaheads, s.lookaheads)
+	}
+	return merged
+}
+
+// calcLALRLookaheads computes the lookaheads of the LR(0) automaton by
+// finding spontaneously generated lookaheads and then propagating them
+// between kernel items
+func (b *lrBuilder) calcLALRLookaheads(states []*lrState) {
+	type kernelRef struct {
+		state int
+		item  int
+	}
+	kernelIndex := make([]map[LRItem]int, len(states))
+	kernelSets := make([][]map[int]struct{}, len(states))
+	for n, s := range states {
+		kernelIndex[n] = map[LRItem]int{}
+		kernelSets[n] = make([]map[int]struct{}, s.kernel)
+		for m, i := range s.items[:s.kernel] {
+			kernelIndex[n][i] = m
+			kernelSets[n][m] = map[int]struct{}{}
+		}
+	}
+	kernelSets[0][0][b.eof] = struct{}{}
+
+	propagate := map[kernelRef][]kernelRef{}
+	for n, s := range states {
+		for m, i := range s.items[:s.kernel] {
+			items, sets := b.closure([]LRItem{i}, []map[int]struct{}{{lrPropagate: {}}})
+			for l, j := range items {
+				sym, ok := b.next(j)
+				if !ok {
+					continue
+				}
+				target := s.gotos[sym]
+				ref := kernelRef{
+					state: target,
+					item: kernelIndex[target][LRItem{
+						rule: j.rule,
+						dot:  j.dot + 1,
+					}],
+				}
+				for k := range sets[l] {
+					if k == lrPropagate {
+						src := kernelRef{
+							state: n,
+							item:  m,
+						}
+						propagate[src] = append(propagate[src], ref)
+						continue
+					}
+					kernelSets[ref.state][ref.item][k] = struct{}{}
+				}
+			}
+		}
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for n, s := range states {
+			for m := 0; m < s.kernel; m++ {
+				src := kernelRef{
+					state: n,
+					item:  m,
+				}
+				for _, dst := range propagate[src] {
+					for k := range kernelSets[n][m] {
+						if _, ok := kernelSets[dst.state][dst.item][k]; !ok {
+							kernelSets[dst.state][dst.item][k] = struct{}{}
+							changed = true
+						}
+					}
+				}
+			}
+		}
+	}
+
+	for n, s := range states {
+		_, s.lookaheads = b.closure(s.items[:s.kernel], kernelSets[n])
+	}
+}
+
+// kernelNonTerm returns the nonterminal of the kernel items of the state, if
+// they share one other than that of the augmented start rule
+func (b *lrBuilder) kernelNonTerm(s *lrState) *GrammarSym {
+	var sym *GrammarSym
+	for _, i := range s.items[:s.kernel] {
+		if i.rule == b.augmented {
+			return nil
+		}
+		from := b.rules[i.rule].From()
+		if sym == nil {
+			sym = &from
+			continue
+		}
+		if *sym != from {
+			return nil
+		}
+	}
+	return sym
+}
+
+// parseError returns an error at the token for the states which have no
+// action on it, which expects the terminals with actions in any of them
+func (t *lrTable) parseError(states []int, pos int, token Token) *ParseError {
+	expected := map[int]struct{}{}
+	var nonTerm *GrammarSym
+	for n, i := range states {
+		for k := range t.actions[i] {
+			expected[k] = struct{}{}
+		}
+		if n == 0 {
+			nonTerm = t.nonTerms[i]
+		} else if nonTerm != nil && (t.nonTerms[i] == nil || *t.nonTerms[i] != *nonTerm) {
+			nonTerm = nil
+		}
+	}
+	return &ParseError{
+		pos:      pos,
+		token:    token,
+		nonTerm:  nonTerm,
+		expected: symsFromSet(expected, true),
+	}
+}
+
+// table builds the parse table of the automaton. When a state has no
+// lookaheads, reductions are made on the FOLLOW set of the nonterminal. Shift
+// reduce conflicts are resolved by precedence where declared.
+func (b *lrBuilder) table(states []*lrState, followSet *changeIntIntSet) *lrTable {
+	t := &lrTable{
+		rules:     b.rules,
+		actions:   make([]map[int][]LRAction, len(states)),
+		gotos:     make([]map[int]int, len(states)),
+		conflicts: []LRConflict{},
+		resolved:  []LRConflict{},
+		nonTerms:  make([]*GrammarSym, len(states)),
+	}
+	for n, s := range states {
+		t.nonTerms[n] = b.kernelNonTerm(s)
+		actions := map[int][]LRAction{}
+		items := map[int][]LRItem{}
+		terms := []int{}
+		add := func(t int, a LRAction, item LRItem) {
+			if _, ok := actions[t]; !ok {
+				terms = append(terms, t)
+			}
+			found := false
+			for _, i := range actions[t] {
+				if i == a {
+					found = true
+					break
+				}
+			}
+			if !found {
+				actions[t] = append(actions[t], a)
+			}
+			items[t] = append(items[t], item)
+		}
+		gotos := map[int]int{}
+		for m, i := range s.items {
+			sym, ok := b.next(i)
+			if ok {
+				if sym.term {
+					add(sym.kind, LRAction{
+						kind:   LRActionShift,
+						target: s.gotos[sym],
+					}, i)
+				} else {
+					gotos[sym.kind] = s.gotos[sym]
+				}
+				continue
+			}
+			if i.rule == b.augmented {
+				add(b.eof, LRAction{
+					kind:   LRActionAccept,
+					target: i.rule,
+				}, i)
+				continue
+			}
+			var la map[int]struct{}
+			if s.lookaheads != nil {
+				la = s.lookaheads[m]
+			} else {
+				la = followSet.iter(b.rules[i.rule].from)
+			}
+			for _, k := range sortedIntSet(la) {
+				add(k, LRAction{
+					kind:   LRActionReduce,
+					target: i.rule,
+				}, i)
+			}
+		}
+		t.actions[n] = actions
+		t.gotos[n] = gotos
+		for _, k := range terms {
+			if len(actions[k]) < 2 {
+				continue
+			}
+			c := LRConflict{
+				state:     n,
+				lookahead: NewGrammarTerm(k),
+				actions:   actions[k],
+				items:     items[k],
+				rules:     b.rules,
+				resolved:  false,
+			}
+			kept, ok := b.prec.resolve(b.rules, k, actions[k])
+			if !ok {
+				t.conflicts = append(t.conflicts, c)
+				continue
+			}
+			c.resolved = true
+			c.kept = kept
+			t.resolved = append(t.resolved, c)
+			if len(kept) == 0 {
+				delete(actions, k)
+			} else {
+				actions[k] = kept
+			}
+			if len(kept) > 1 {
+				t.conflicts = append(t.conflicts, LRConflict{
+					state:     n,
+					lookahead: NewGrammarTerm(k),
+					actions:   kept,
+					items:     b.actionItems(items[k], kept),
+					rules:     b.rules,
+					resolved:  false,
+				})
+			}
+		}
+	}
+	return t
+}
+
+// actionItems returns the items which produce any of the actions
+func (b *lrBuilder) actionItems(items []LRItem, actions []LRAction) []LRItem {
+	kept := []LRItem{}
+	for _, i := range items {
+		a := LRAction{
+			kind:   LRActionReduce,
+			target: i.rule,
+		}
+		if i.dot < len(b.rules[i.rule].to) {
+			a.kind = LRActionShift
+		} else if i.rule == b.augmented {
+			a.kind = LRActionAccept
+		}
+		for _, j := range actions {
+			if j.kind == a.kind && (a.kind == LRActionShift || j.target == a.target) {
+				kept = append(kept, i)
+				break
+			}
+		}
+	}
+	return kept
+}
+
+// LRParserPrecedence sets the precedence declarations used to resolve
+// shift reduce conflicts
+func LRParserPrecedence(prec *LRPrecedence) LRParserOpt {
+	return func(p *LRParser) {
+		p.prec = prec
+	}
+}
+
+// NewLRParser creates a shift-reduce parser with a table generated by the
+// given mode
+func NewLRParser(rules []GrammarRule, start, eof GrammarSym, mode LRMode, opts ...LRParserOpt) (*LRParser, error) {
+	if err := checkGrammarErr(CheckGrammar(rules, start, eof)); err != nil {
+		return nil, err
+	}
+	p := &LRParser{
+		start: start,
+		eof:   eof,
+		prec:  nil,
+	}
+	for _, i := range opts {
+		i(p)
+	}
+	b := newLRBuilder(rules, start, eof)
+	b.prec = p.prec
+	var states []*lrState
+	var followSet *changeIntIntSet
+	switch mode {
+	case LRModeSLR:
+		states = b.states(false)
+		followSet = calcLL1FollowSet(rules, start.Kind(), eof.Kind(), calcLL1FirstSet(rules, b.nullable), b.nullable)
+	case LRModeLALR:
+		states = b.states(false)
+		b.calcLALRLookaheads(states)
+	case LRModeCanonical:
+		states = b.states(true)
+	case LRModeMinimal:
+		states = b.mergeStates(b.states(true))
+	default:
+		return nil, fmt.Errorf("Invalid LR mode: %d: %w", mode, ErrGrammar)
+	}
+	table := b.table(states, followSet)
+	if len(table.conflicts) > 0 {
+		return nil, &LRConflictError{
+			mode:      mode,
+			conflicts: table.conflicts,
+			resolved:  table.resolved,
+		}
+	}
+	p.table = table
+	return p, nil
+}
+
+func NewLRParserFromGrammar(g *Grammar, mode LRMode, opts ...LRParserOpt) (*LRParser, error) {
+	return NewLRParser(g.rules, g.start, g.eof, mode, opts...)
+}
+
+// Resolved returns the conflicts of the parse table which were resolved by
+// precedence
+func (p *LRParser) Resolved() []LRConflict {
+	return p.table.resolved
+}
+
+// States returns the number of states of the parse table
+func (p *LRParser) States() int {
+	return len(p.table.actions)
+}
+
+// Parse parses the tokens. If a token is unexpected, the error is a
+// *ParseError reporting the terminals with actions in the current state.
+func (p *LRParser) Parse(tokens []Token) (*ParseTree, error) {
+	states := []int{0}
+	nodes := []*ParseTree{}
+	for pos := 0; pos < len(tokens); {
+		token := tokens[pos]
+		state := states[len(states)-1]
+		actions := p.table.actions[state][token.Kind()]
+		if len(actions) == 0 {
+			return nil, p.table.parseError([]int{state}, pos, token)
+		}
+		a := actions[0]
+		switch a.kind {
+		case LRActionShift:
+			nodes = append(nodes, newParseTreeLeaf(NewGrammarTerm(token.Kind()), token))
+			states = append(states, a.target)
+			pos++
+		case LRActionReduce:
+			r := p.table.rules[a.target]
+			k := len(nodes) - len(r.to)
+			node := newParseTree(r.From())
+			for _, i := range nodes[k:] {
+				node.addChild(i)
+			}
+			nodes = append(nodes[:k], node)
+			states = states[:len(states)-len(r.to)]
+			states = append(states, p.table.gotos[states[len(states)-1]][r.from])
+		case LRActionAccept:
+			if len(nodes) != 1 {
+				return nil, fmt.Errorf("Unexpected parse tree shape: %w", ErrParseInternal)
+			}
+			return nodes[0], nil
+		default:
+			return nil, fmt.Errorf("Invalid parse action: %w", ErrParseInternal)
+		}
+	}
+	return nil, fmt.Errorf("Unexpected end of token stream: %w", ErrParse)
+}
@@ -0,0 +1,428 @@
+package gnom
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestNewLRParser(t *testing.T) {
+	assert := assert.New(t)
+
+	g := NewGrammarSymGenerator()
+
+	S := g.NonTerm()
+	eof := g.Term()
+
+	L := g.NonTerm()
+	R := g.NonTerm()
+	eq := g.Term()
+	star := g.Term()
+	id := g.Term()
+
+	// assignment grammar is LALR(1) but not SLR(1)
+	rules := []GrammarRule{
+		NewGrammarRule(S, L, eq, R),
+		NewGrammarRule(S, R),
+		NewGrammarRule(L, star, R),
+		NewGrammarRule(L, id),
+		NewGrammarRule(R, L),
+	}
+
+	_, err := NewLRParser(rules, S, eof, LRModeSLR)
+	assert.Error(err, "Grammar should not be SLR(1)")
+	assert.True(errors.Is(err, ErrGrammar), "Conflict should be a grammar error")
+	var cerr *LRConflictError
+	assert.True(errors.As(err, &cerr), "Error should be a conflict error")
+	assert.Len(cerr.Conflicts(), 1)
+	conflict := cerr.Conflicts()[0]
+	assert.Equal(eq, conflict.Lookahead())
+	assert.Equal([]LRAction{
+		{
+			kind:   LRActionShift,
+			target: conflict.Actions()[0].Target(),
+		},
+		{
+			kind:   LRActionReduce,
+			target: 4,
+		},
+	}, conflict.Actions())
+	assert.Equal([]LRItem{
+		{
+			rule: 0,
+			dot:  1,
+		},
+		{
+			rule: 4,
+			dot:  1,
+		},
+	}, conflict.Items())
+	assert.Contains(err.Error(), "(n0 -> n2 . t4 n3; n3 -> n2 .)")
+
+	_, err = NewLRParser(rules, S, eof, LRModeLALR)
+	assert.NoErrorf(err, "Grammar should be LALR(1): %v", err)
+
+	{
+		lalr, err := NewLRParser(rules, S, eof, LRModeLALR)
+		assert.NoError(err, "Failed to create parser")
+		canonical, err := NewLRParser(rules, S, eof, LRModeCanonical)
+		assert.NoError(err, "Grammar should be LR(1)")
+		minimal, err := NewLRParser(rules, S, eof, LRModeMinimal)
+		assert.NoError(err, "Grammar should be minimal LR(1)")
+		assert.Equal(lalr.States(), minimal.States(), "Minimal LR(1) should merge as LALR(1) without conflicts")
+		assert.Less(minimal.States(), canonical.States(), "Minimal LR(1) should merge states")
+	}
+
+	// grammar is LR(1) but merging states with the same core introduces a
+	// reduce-reduce conflict
+	A := g.NonTerm()
+	B := g.NonTerm()
+	a := g.Term()
+	b := g.Term()
+	c := g.Term()
+	d := g.Term()
+	e := g.Term()
+	lr1Rules := []GrammarRule{
+		NewGrammarRule(S, a, A, d),
+		NewGrammarRule(S, b, B, d),
+		NewGrammarRule(S, a, B, e),
+		NewGrammarRule(S, b, A, e),
+		NewGrammarRule(A, c),
+		NewGrammarRule(B, c),
+	}
+	_, err = NewLRParser(lr1Rules, S, eof, LRModeLALR)
+	assert.Error(err, "Grammar should not be LALR(1)")
+	assert.True(errors.As(err, &cerr), "Error should be a conflict error")
+	assert.Len(cerr.Conflicts(), 2)
+	for _, i := range cerr.Conflicts() {
+		assert.Equal([]LRAction{
+			{
+				kind:   LRActionReduce,
+				target: 4,
+			},
+			{
+				kind:   LRActionReduce,
+				target: 5,
+			},
+		}, i.Actions())
+		assert.Equal([]LRItem{
+			{
+				rule: 4,
+				dot:  1,
+			},
+			{
+				rule: 5,
+				dot:  1,
+			},
+		}, i.Items())
+	}
+	assert.Contains(err.Error(), "reduce 4, reduce 5 (n7 -> t11 .; n8 -> t11 .)")
+	{
+		canonical, err := NewLRParser(lr1Rules, S, eof, LRModeCanonical)
+		assert.NoErrorf(err, "Grammar should be LR(1): %v", err)
+		minimal, err := NewLRParser(lr1Rules, S, eof, LRModeMinimal)
+		assert.NoErrorf(err, "Grammar should be minimal LR(1): %v", err)
+		assert.Equal(canonical.States(), minimal.States(), "Conflicting states should not be merged")
+		for _, parser := range []*LRParser{canonical, minimal} {
+			tree, err := parser.Parse([]Token{
+				newToken(b.Kind(), "b"),
+				newToken(c.Kind(), "c"),
+				newToken(e.Kind(), "e"),
+				newToken(eof.Kind(), ""),
+			})
+			assert.NoError(err, "Failed to parse")
+			assert.Equal("0(b 7(c) e)", parseTreeString(tree))
+		}
+	}
+
+	_, err = NewLRParser([]GrammarRule{
+		NewGrammarRule(S, S, S),
+		NewGrammarRule(S, id),
+	}, S, eof, LRModeLALR)
+	assert.Error(err, "Ambiguous grammar should have conflicts")
+	assert.Contains(err.Error(), "Grammar is not LALR(1)")
+}
+
+func TestLRParser_Parse(t *testing.T) {
+	assert := assert.New(t)
+
+	g := NewGrammarSymGenerator()
+
+	E := g.NonTerm()
+	eof := g.Term()
+
+	T := g.NonTerm()
+	F := g.NonTerm()
+	num := g.Term()
+	plus := g.Term()
+	star := g.Term()
+	lparen := g.Term()
+	rparen := g.Term()
+	A := g.NonTerm()
+
+	rules := []GrammarRule{
+		NewGrammarRule(E, E, plus, T),
+		NewGrammarRule(E, T),
+		NewGrammarRule(T, T, star, F),
+		NewGrammarRule(T, F),
+		NewGrammarRule(F, num, A),
+		NewGrammarRule(F, lparen, E, rparen),
+		NewGrammarRule(A),
+	}
+
+	for _, mode := range []LRMode{LRModeSLR, LRModeLALR, LRModeCanonical, LRModeMinimal} {
+		parser, err := NewLRParser(rules, E, eof, mode)
+		assert.NoErrorf(err, "Failed to create parser: %s, %v", mode, err)
+
+		for n, c := range []struct {
+			tokens   []Token
+			exp      string
+			err      error
+			pos      int
+			expected []GrammarSym
+		}{
+			{
+				tokens: []Token{
+					newToken(num.Kind(), "1"),
+					newToken(plus.Kind(), "+"),
+					newToken(num.Kind(), "2"),
+					newToken(star.Kind(), "*"),
+					newToken(lparen.Kind(), "("),
+					newToken(num.Kind(), "3"),
+					newToken(plus.Kind(), "+"),
+					newToken(num.Kind(), "4"),
+					newToken(rparen.Kind(), ")"),
+					newToken(eof.Kind(), ""),
+				},
+				exp: "0(0(2(3(1 9()))) + 2(2(3(2 9())) * 3(( 0(0(2(3(3 9()))) + 2(3(4 9()))) ))))",
+			},
+			{
+				tokens: []Token{
+					newToken(num.Kind(), "1"),
+					newToken(plus.Kind(), "+"),
+					newToken(eof.Kind(), ""),
+				},
+				err:      ErrParse,
+				pos:      2,
+				expected: []GrammarSym{num, lparen},
+			},
+			{
+				tokens: []Token{
+					newToken(num.Kind(), "1"),
+				},
+				err: ErrParse,
+			},
+		} {
+			tree, err := parser.Parse(c.tokens)
+			if c.err != nil {
+				assert.Errorf(err, "Should fail to parse: %s case %d", mode, n)
+				assert.Truef(errors.Is(err, c.err), "Should fail to parse: %s case %d", mode, n)
+				var perr *ParseError
+				if c.expected != nil && assert.Truef(errors.As(err, &perr), "Should report expected terminals: %s case %d", mode, n) {
+					assert.Equalf(c.pos, perr.Pos(), "Fail %s case %d", mode, n)
+					assert.Equalf(c.tokens[c.pos], perr.Token(), "Fail %s case %d", mode, n)
+					nonTerm, ok := perr.NonTerm()
+					assert.Truef(ok, "Fail %s case %d", mode, n)
+					assert.Equalf(E, nonTerm, "Fail %s case %d", mode, n)
+					assert.Equalf(c.expected, perr.Expected(), "Fail %s case %d", mode, n)
+				}
+				continue
+			}
+			assert.NoErrorf(err, "Failed to parse: %s case %d, %v", mode, n, err)
+			assert.Equalf(c.exp, parseTreeString(tree), "Fail %s case %d", mode, n)
+			_, ok := checkParseTree(rules, tree)
+			assert.Truef(ok, "Invalid parse tree: %s case %d", mode, n)
+		}
+	}
+}
+
+func TestLRParser_Precedence(t *testing.T) {
+	assert := assert.New(t)
+
+	g := NewGrammarSymGenerator()
+
+	E := g.NonTerm()
+	eof := g.Term()
+
+	num := g.Term()
+	plus := g.Term()
+	minus := g.Term()
+	star := g.Term()
+	caret := g.Term()
+	lt := g.Term()
+	lparen := g.Term()
+	rparen := g.Term()
+	uminus := g.Term()
+
+	terms := map[string]GrammarSym{
+		"+": plus,
+		"-": minus,
+		"*": star,
+		"^": caret,
+		"<": lt,
+		"(": lparen,
+		")": rparen,
+	}
+	lex := func(s string) []Token {
+		tokens := []Token{}
+		for _, i := range strings.Fields(s) {
+			if k, ok := terms[i]; ok {
+				tokens = append(tokens, newToken(k.Kind(), i))
+			} else {
+				tokens = append(tokens, newToken(num.Kind(), i))
+			}
+		}
+		return append(tokens, newToken(eof.Kind(), ""))
+	}
+
+	rules := []GrammarRule{
+		NewGrammarRule(E, E, plus, E),
+		NewGrammarRule(E, E, minus, E),
+		NewGrammarRule(E, E, star, E),
+		NewGrammarRule(E, E, caret, E),
+		NewGrammarRule(E, E, lt, E),
+		NewGrammarRule(E, minus, E).WithPrec(uminus),
+		NewGrammarRule(E, lparen, E, rparen),
+		NewGrammarRule(E, num),
+	}
+	prec := NewLRPrecedence().
+		NonAssoc(lt).
+		Left(plus, minus).
+		Left(star).
+		Right(caret).
+		Right(uminus)
+
+	for _, mode := range []LRMode{LRModeSLR, LRModeLALR, LRModeCanonical, LRModeMinimal} {
+		parser, err := NewLRParser(rules, E, eof, mode, LRParserPrecedence(prec))
+		assert.NoErrorf(err, "Failed to create parser: %s, %v", mode, err)
+		assert.NotEmptyf(parser.Resolved(), "Conflicts should be resolved: %s", mode)
+		for _, i := range parser.Resolved() {
+			assert.Truef(i.Resolved(), "Conflict should be resolved: %s", mode)
+			assert.Containsf(i.String(), ": resolved as ", "Fail %s", mode)
+		}
+
+		for n, c := range []struct {
+			input string
+			exp   string
+		}{
+			{
+				input: "1 + 2 * 3",
+				exp:   "0(0(1) + 0(0(2) * 0(3)))",
+			},
+			{
+				input: "1 - 2 - 3",
+				exp:   "0(0(0(1) - 0(2)) - 0(3))",
+			},
+			{
+				input: "2 ^ 3 ^ 4",
+				exp:   "0(0(2) ^ 0(0(3) ^ 0(4)))",
+			},
+			{
+				input: "- 1 * 2",
+				exp:   "0(0(- 0(1)) * 0(2))",
+			},
+			{
+				input: "- 2 ^ 3",
+				exp:   "0(0(- 0(2)) ^ 0(3))",
+			},
+			{
+				input: "( 1 + 2 ) * 3",
+				exp:   "0(0(( 0(0(1) + 0(2)) )) * 0(3))",
+			},
+			{
+				input: "1 < 2 + 3",
+				exp:   "0(0(1) < 0(0(2) + 0(3)))",
+			},
+			{
+				input: "1 < 2 < 3",
+			},
+		} {
+			tree, err := parser.Parse(lex(c.input))
+			if c.exp == "" {
+				assert.Errorf(err, "Should fail to parse: %s case %d", mode, n)
+				assert.Truef(errors.Is(err, ErrParse), "Should fail to parse: %s case %d", mode, n)
+				continue
+			}
+			assert.NoErrorf(err, "Failed to parse: %s case %d, %v", mode, n, err)
+			assert.Equalf(c.exp, parseTreeString(tree), "Fail %s case %d", mode, n)
+		}
+	}
+
+	{
+		// conflicts involving terminals without precedence remain
+		_, err := NewLRParser(rules, E, eof, LRModeLALR, LRParserPrecedence(NewLRPrecedence().
+			NonAssoc(lt).
+			Left(plus, minus).
+			Left(star).
+			Right(uminus),
+		))
+		var cerr *LRConflictError
+		if assert.True(errors.As(err, &cerr), "Should fail with conflicts") {
+			assert.NotEmpty(cerr.Resolved())
+			assert.NotEmpty(cerr.Conflicts())
+			for _, i := range cerr.Conflicts() {
+				assert.False(i.Resolved())
+				found := i.Lookahead() == caret
+				for _, j := range i.Actions() {
+					if j.Kind() == LRActionReduce && j.Target() == 3 {
+						found = true
+					}
+				}
+				assert.True(found, "Remaining conflicts should involve the undeclared terminal")
+			}
+		}
+	}
+
+	{
+		// a shift is resolved against each of several reduces
+		S := g.NonTerm()
+		A := g.NonTerm()
+		B := g.NonTerm()
+		x := g.Term()
+		y := g.Term()
+		rules := []GrammarRule{
+			NewGrammarRule(S, x, y),
+			NewGrammarRule(S, A, y),
+			NewGrammarRule(S, B, y),
+			NewGrammarRule(A, x),
+			NewGrammarRule(B, x),
+		}
+
+		parser, err := NewLRParser(rules, S, eof, LRModeLALR, LRParserPrecedence(NewLRPrecedence().Left(x).Left(y)))
+		assert.NoError(err, "Shift should win against every reduce")
+		if assert.Len(parser.Resolved(), 1) {
+			c := parser.Resolved()[0]
+			assert.Len(c.Actions(), 3, "Conflict should have a shift and two reduces")
+			if assert.Len(c.Resolution(), 1) {
+				assert.Equal(LRActionShift, c.Resolution()[0].Kind())
+			}
+		}
+
+		_, err = NewLRParser(rules, S, eof, LRModeLALR, LRParserPrecedence(NewLRPrecedence().Left(y).Left(x)))
+		var cerr *LRConflictError
+		if assert.True(errors.As(err, &cerr), "Reduce reduce conflict should remain") {
+			assert.Len(cerr.Resolved(), 1)
+			if assert.Len(cerr.Conflicts(), 1) {
+				c := cerr.Conflicts()[0]
+				assert.False(c.Resolved())
+				assert.Equal(y, c.Lookahead())
+				assert.Equal([]LRAction{
+					{kind: LRActionReduce, target: 3},
+					{kind: LRActionReduce, target: 4},
+				}, c.Actions())
+				assert.Len(c.Items(), 2, "Conflict should only have the items of the reduces")
+			}
+		}
+	}
+
+	{
+		parser, err := NewGLRParser(rules, E, eof, GLRParserPrecedence(prec))
+		assert.NoError(err, "Failed to create parser")
+		assert.Empty(parser.Conflicts())
+		assert.NotEmpty(parser.Resolved())
+		tree, err := parser.Parse(lex("1 + 2 * 3 - 4"))
+		assert.NoError(err, "Failed to parse")
+		assert.Equal("0(0(0(1) + 0(0(2) * 0(3))) - 0(4))", parseTreeString(tree))
+	}
+}
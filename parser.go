@@ -3,6 +3,8 @@ package gnom
 import (
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 )
 
 var (
@@ -13,6 +15,7 @@ type (
 	GrammarSym struct {
 		term bool
 		kind int
+		op   PEGOp
 	}
 
 	GrammarSymGenerator struct {
@@ -22,6 +25,7 @@ type (
 	GrammarRule struct {
 		from int
 		to   []GrammarSym
+		prec *GrammarSym
 	}
 )
 
@@ -47,6 +51,33 @@ func (s *GrammarSym) Kind() int {
 	return s.kind
 }
 
+func (s GrammarSym) String() string {
+	var k string
+	if s.term {
+		k = "t" + strconv.Itoa(s.kind)
+	} else {
+		k = "n" + strconv.Itoa(s.kind)
+	}
+	switch s.op {
+	case PEGOpCut:
+		return "~"
+	case PEGOpPredicate:
+		return "&{" + strconv.Itoa(s.kind) + "}"
+	case PEGOpAnd:
+		return "&" + k
+	case PEGOpNot:
+		return "!" + k
+	case PEGOpZeroOrMore:
+		return k + "*"
+	case PEGOpOneOrMore:
+		return k + "+"
+	case PEGOpOptional:
+		return k + "?"
+	default:
+		return k
+	}
+}
+
 func NewGrammarRule(from GrammarSym, to ...GrammarSym) GrammarRule {
 	return GrammarRule{
 		from: from.Kind(),
@@ -54,6 +85,40 @@ func NewGrammarRule(from GrammarSym, to ...GrammarSym) GrammarRule {
 	}
 }
 
+func (r *GrammarRule) From() GrammarSym {
+	return NewGrammarNonTerm(r.from)
+}
+
+func (r *GrammarRule) To() []GrammarSym {
+	return r.to
+}
+
+// WithPrec returns the rule with the precedence of the terminal, like the
+// %prec declaration of yacc
+func (r GrammarRule) WithPrec(term GrammarSym) GrammarRule {
+	r.prec = &term
+	return r
+}
+
+// Prec returns the terminal whose precedence the rule has been given, if any
+func (r *GrammarRule) Prec() (GrammarSym, bool) {
+	if r.prec == nil {
+		return GrammarSym{}, false
+	}
+	return *r.prec, true
+}
+
+func (r GrammarRule) String() string {
+	s := strings.Builder{}
+	s.WriteString(NewGrammarNonTerm(r.from).String())
+	s.WriteString(" ->")
+	for _, i := range r.to {
+		s.WriteString(" ")
+		s.WriteString(i.String())
+	}
+	return s.String()
+}
+
 func NewGrammarSymGenerator() *GrammarSymGenerator {
 	return &GrammarSymGenerator{
 		i: 0,
@@ -239,27 +304,59 @@ func calcLL1FollowSet(rules []GrammarRule, start, eof int, firstSet *changeIntIn
 	}
 }
 
-func calcLL1ParseTable(rules []GrammarRule, nonTerminals *changeIntSet, nullableSet *changeIntSet, firstSet *changeIntIntSet, followSet *changeIntIntSet) (map[int]map[int][]GrammarSym, error) {
+func calcLL1ParseTable(rules []GrammarRule, start, eof int, nonTerminals *changeIntSet, nullableSet *changeIntSet, firstSet *changeIntIntSet, followSet *changeIntIntSet) (map[int]map[int][]GrammarSym, error) {
 	table := map[int]map[int][]GrammarSym{}
 	for nt := range nonTerminals.iter() {
 		table[nt] = map[int][]GrammarSym{}
 	}
-	for n, i := range rules {
-		for j := range calcLL1First(i.to, firstSet, nullableSet) {
-			if _, ok := table[i.from][j]; ok {
-				return nil, fmt.Errorf("Grammar is not LL1: duplicate rule: %d: %w", n, ErrGrammar)
+	entries := map[int]map[int]ll1TableEntry{}
+	var witness *ll1Witness
+	conflicts := []LL1Conflict{}
+	add := func(n int, t int, source LL1ConflictSource) {
+		i := rules[n]
+		if _, ok := entries[i.from]; !ok {
+			entries[i.from] = map[int]ll1TableEntry{}
+		}
+		prev, ok := entries[i.from][t]
+		if !ok {
+			entries[i.from][t] = ll1TableEntry{
+				rule:   n,
+				source: source,
 			}
-			table[i.from][j] = i.to
+			table[i.from][t] = i.to
+			return
+		}
+		if prev.rule == n {
+			return
+		}
+		if witness == nil {
+			witness = newLL1Witness(rules, start, eof, nullableSet)
+		}
+		conflicts = append(conflicts, LL1Conflict{
+			nonTerm:   NewGrammarNonTerm(i.from),
+			lookahead: NewGrammarTerm(t),
+			productions: [2]LL1ConflictProduction{
+				witness.production(prev.rule, t, prev.source),
+				witness.production(n, t, source),
+			},
+			rules: rules,
+		})
+	}
+	for n, i := range rules {
+		for _, j := range sortedIntSet(calcLL1First(i.to, firstSet, nullableSet)) {
+			add(n, j, LL1ConflictFirst)
 		}
 		if isLL1Nullable(i.to, nullableSet) {
-			for j := range followSet.iter(i.from) {
-				if _, ok := table[i.from][j]; ok {
-					return nil, fmt.Errorf("Grammar is not LL1: duplicate rule: %d: %w", n, ErrGrammar)
-				}
-				table[i.from][j] = i.to
+			for _, j := range sortedIntSet(followSet.iter(i.from)) {
+				add(n, j, LL1ConflictFollow)
 			}
 		}
 	}
+	if len(conflicts) > 0 {
+		return nil, &LL1ConflictError{
+			conflicts: conflicts,
+		}
+	}
 	return table, nil
 }
 
@@ -267,6 +364,7 @@ type (
 	tokenStack struct {
 		tokens []Token
 		buf    []Token
+		pos    int
 	}
 )
 
@@ -274,9 +372,15 @@ func newTokenStack(tokens []Token) *tokenStack {
 	return &tokenStack{
 		tokens: tokens,
 		buf:    []Token{},
+		pos:    0,
 	}
 }
 
+// Pos returns the index of the next token
+func (s *tokenStack) Pos() int {
+	return s.pos
+}
+
 func (s *tokenStack) Empty() bool {
 	return len(s.tokens) == 0 && len(s.buf) == 0
 }
@@ -288,10 +392,12 @@ func (s *tokenStack) Pop() (Token, bool) {
 		}
 		k := s.tokens[0]
 		s.tokens = s.tokens[1:]
+		s.pos++
 		return k, true
 	}
 	k := s.buf[len(s.buf)-1]
 	s.buf = s.buf[:len(s.buf)-1]
+	s.pos++
 	return k, true
 }
 
@@ -305,8 +411,21 @@ func (s *tokenStack) Peek() (Token, bool) {
 	return s.buf[len(s.buf)-1], true
 }
 
+// PeekN returns up to the next n tokens
+func (s *tokenStack) PeekN(n int) []Token {
+	k := make([]Token, 0, n)
+	for i := len(s.buf) - 1; i >= 0 && len(k) < n; i-- {
+		k = append(k, s.buf[i])
+	}
+	for i := 0; i < len(s.tokens) && len(k) < n; i++ {
+		k = append(k, s.tokens[i])
+	}
+	return k
+}
+
 func (s *tokenStack) Push(t Token) {
 	s.buf = append(s.buf, t)
+	s.pos--
 }
 
 type (
@@ -314,6 +433,7 @@ type (
 		sym      GrammarSym
 		token    Token
 		children []*ParseTree
+		err      bool
 	}
 )
 
@@ -332,10 +452,26 @@ func newParseTreeLeaf(sym GrammarSym, token Token) *ParseTree {
 	}
 }
 
+// newParseTreeErr creates an error node in place of the symbol, whose
+// children are the skipped tokens
+func newParseTreeErr(sym GrammarSym) *ParseTree {
+	return &ParseTree{
+		sym:      sym,
+		children: []*ParseTree{},
+		err:      true,
+	}
+}
+
 func (t *ParseTree) Term() bool {
 	return t.sym.Term()
 }
 
+// Err returns true if the node is an error node of a parser recovering from
+// errors, in place of its symbol
+func (t *ParseTree) Err() bool {
+	return t.err
+}
+
 func (t *ParseTree) Kind() int {
 	return t.sym.Kind()
 }
@@ -360,14 +496,17 @@ func (t *ParseTree) addChild(child *ParseTree) {
 	t.children = append(t.children, child)
 }
 
-func (t *ParseTree) popChild() {
-	t.children = t.children[:len(t.children)-1]
-}
-
 type (
 	ll1SymMatcher struct {
 		syms []GrammarSym
 		node *ParseTree
+		// root is true for the matcher of the start symbol and EOF, whose
+		// node is not of a nonterminal
+		root bool
+		// expr parses the expression of an operator table of the node, and
+		// wait is true while the matcher matches an operand of it
+		expr *opParser
+		wait bool
 	}
 )
 
@@ -375,6 +514,25 @@ func newLL1SymMatcher(syms []GrammarSym, node *ParseTree) *ll1SymMatcher {
 	return &ll1SymMatcher{
 		syms: syms,
 		node: node,
+		root: false,
+	}
+}
+
+func newLL1ExprMatcher(g *opGrammar, node *ParseTree) *ll1SymMatcher {
+	return &ll1SymMatcher{
+		syms: []GrammarSym{},
+		node: node,
+		root: false,
+		expr: newOpParser(g),
+		wait: false,
+	}
+}
+
+func newLL1RootMatcher(start, eof GrammarSym, node *ParseTree) *ll1SymMatcher {
+	return &ll1SymMatcher{
+		syms: []GrammarSym{start, eof},
+		node: node,
+		root: true,
 	}
 }
 
@@ -398,6 +556,82 @@ func (m *ll1SymMatcher) Match(node *ParseTree) bool {
 	return true
 }
 
+// parseError returns an error at the token in place of the next symbol of the
+// matcher
+func (m *ll1SymMatcher) parseError(pos int, token Token) *ParseError {
+	err := &ParseError{
+		pos:      pos,
+		token:    token,
+		nonTerm:  nil,
+		expected: []GrammarSym{m.syms[0]},
+	}
+	if !m.root {
+		sym := m.node.sym
+		err.nonTerm = &sym
+	}
+	return err
+}
+
+// StepExpr advances the expression of the matcher once its operand, if any,
+// is matched. It returns true when the matcher is to match another operand,
+// and otherwise builds the operator nodes of the expression. An operand is
+// only matched if predict accepts the next token for the expression. Errors
+// are passed to report, and if it returns true, parsing continues with an
+// error node in place of a missing operand.
+func (m *ll1SymMatcher) StepExpr(ts *tokenStack, predict func(nt int, ts *tokenStack) ([]GrammarSym, error), report func(err error) bool) (bool, error) {
+	o := m.expr
+	operand := o.g.table.operand
+	if m.wait {
+		m.wait = false
+		k := len(m.node.children) - 1
+		node := m.node.children[k]
+		m.node.children = m.node.children[:k]
+		if err := o.Operand(node); err != nil && !report(err) {
+			return false, err
+		}
+	}
+	for {
+		pos := ts.Pos()
+		next, ok := ts.Peek()
+		if !ok {
+			o.Backoff()
+			m.node.children = o.Tree().children
+			return false, fmt.Errorf("Unexpected end of token stream: %w", ErrParse)
+		}
+		if o.ExpectOperand() {
+			if op, ok := o.g.op(OpPrefix, next.Kind()); ok {
+				ts.Pop()
+				o.Prefix(op, newParseTreeLeaf(op.term, next), pos)
+				continue
+			}
+			if _, err := predict(o.g.table.expr.kind, ts); err != nil {
+				if !report(err) {
+					return false, err
+				}
+				if err := o.Operand(newParseTreeErr(operand)); err != nil && !report(err) {
+					return false, err
+				}
+				continue
+			}
+			m.syms = []GrammarSym{operand}
+			m.wait = true
+			return true, nil
+		}
+		if op, ok := o.g.op(OpInfix, next.Kind()); ok {
+			ts.Pop()
+			o.Infix(op, newParseTreeLeaf(op.term, next), pos)
+			continue
+		}
+		if op, ok := o.g.op(OpPostfix, next.Kind()); ok {
+			ts.Pop()
+			o.Postfix(op, newParseTreeLeaf(op.term, next))
+			continue
+		}
+		m.node.children = o.Tree().children
+		return false, nil
+	}
+}
+
 type (
 	ll1SymMatcherStack struct {
 		stack []*ll1SymMatcher
@@ -436,38 +670,56 @@ func (s *ll1SymMatcherStack) Pop() (*ll1SymMatcher, bool) {
 
 type (
 	LL1Parser struct {
-		table map[int]map[int][]GrammarSym
-		start GrammarSym
-		eof   GrammarSym
+		table    map[int]map[int][]GrammarSym
+		start    GrammarSym
+		eof      GrammarSym
+		opTables []*OperatorTable
+		exprs    map[int]*opGrammar
+		follow   *changeIntIntSet
+		sync     map[int]struct{}
 	}
+
+	LL1ParserOpt func(p *LL1Parser)
 )
 
-func NewLL1Parser(rules []GrammarRule, start, eof GrammarSym) (*LL1Parser, error) {
-	nonTerminals := newChangeIntSet()
-	for _, i := range rules {
-		nonTerminals.upsert(i.from)
+// LL1ParserOperators adds operator tables, each of which defines an
+// expression nonterminal
+func LL1ParserOperators(tables ...*OperatorTable) LL1ParserOpt {
+	return func(p *LL1Parser) {
+		p.opTables = append(p.opTables, tables...)
 	}
-	for _, i := range rules {
-		for _, j := range i.to {
-			if !j.term && !nonTerminals.contains(j.kind) {
-				return nil, fmt.Errorf("Nonterminal lacks production rule: %d: %w", j.kind, ErrGrammar)
-			}
-		}
-	}
-	nullableSet := calcLL1NullableSet(rules)
-	firstSet := calcLL1FirstSet(rules, nullableSet)
-	followSet := calcLL1FollowSet(rules, start.Kind(), eof.Kind(), firstSet, nullableSet)
+}
 
-	parseTable, err := calcLL1ParseTable(rules, nonTerminals, nullableSet, firstSet, followSet)
+func NewLL1Parser(rules []GrammarRule, start, eof GrammarSym, opts ...LL1ParserOpt) (*LL1Parser, error) {
+	p := &LL1Parser{
+		start:    start,
+		eof:      eof,
+		opTables: []*OperatorTable{},
+		sync:     map[int]struct{}{},
+	}
+	for _, i := range opts {
+		i(p)
+	}
+	rules, exprs, err := expandOperatorTables(rules, start, eof, p.opTables)
 	if err != nil {
 		return nil, err
 	}
+	if err := checkGrammarErr(CheckGrammar(rules, start, eof)); err != nil {
+		return nil, err
+	}
+	a := NewGrammarAnalysis(rules, start, eof)
+	parseTable, err := calcLL1ParseTable(rules, start.Kind(), eof.Kind(), a.nonTerminals, a.nullableSet, a.firstSet, a.followSet)
+	if err != nil {
+		return nil, err
+	}
+	p.table = parseTable
+	p.exprs = exprs
+	p.follow = a.followSet
+	return p, nil
+}
 
-	return &LL1Parser{
-		table: parseTable,
-		start: start,
-		eof:   eof,
-	}, nil
+func NewLL1ParserFromGrammar(g *Grammar, opts ...LL1ParserOpt) (*LL1Parser, error) {
+	return NewLL1Parser(g.rules, g.start, g.eof, opts...)
 }
 
 func (p *LL1Parser) getProduction(nt, t int) ([]GrammarSym, bool) {
@@ -482,147 +734,166 @@ func (p *LL1Parser) getProduction(nt, t int) ([]GrammarSym, bool) {
 	return prod, true
 }
 
+// rowSet returns the terminals of the parse table row of a nonterminal
+func (p *LL1Parser) rowSet(nt int) map[int]struct{} {
+	set := map[int]struct{}{}
+	for k := range p.table[nt] {
+		set[k] = struct{}{}
+	}
+	return set
+}
+
 var (
 	ErrParse         = errors.New("parser error")
 	ErrParseInternal = errors.New("internal parser error")
 )
 
+type (
+	// ParseError is an error at an offending token, which reports the
+	// nonterminal being expanded and the terminals that may have been parsed
+	// instead
+	ParseError struct {
+		pos      int
+		token    Token
+		nonTerm  *GrammarSym
+		expected []GrammarSym
+	}
+)
+
+// Pos returns the index of the offending token
+func (e *ParseError) Pos() int {
+	return e.pos
+}
+
+func (e *ParseError) Token() Token {
+	return e.token
+}
+
+// NonTerm returns the nonterminal being expanded at the offending token, if
+// the parser knows of one
+func (e *ParseError) NonTerm() (GrammarSym, bool) {
+	if e.nonTerm == nil {
+		return GrammarSym{}, false
+	}
+	return *e.nonTerm, true
+}
+
+// Expected returns the terminals which may have been parsed at the offending
+// token sorted by kind. It is empty if the parser reports none, as for a
+// chained non associative operator.
+func (e *ParseError) Expected() []GrammarSym {
+	return e.expected
+}
+
+func (e *ParseError) Error() string {
+	s := strings.Builder{}
+	fmt.Fprintf(&s, "Unexpected token at %d: %s: ", e.pos, e.token.Val())
+	if e.nonTerm != nil {
+		fmt.Fprintf(&s, "in %s: ", e.nonTerm)
+	}
+	if len(e.expected) > 0 {
+		s.WriteString("expected")
+		for _, i := range e.expected {
+			s.WriteString(" ")
+			s.WriteString(i.String())
+		}
+		s.WriteString(": ")
+	}
+	s.WriteString(ErrParse.Error())
+	return s.String()
+}
+
+func (e *ParseError) Unwrap() error {
+	return ErrParse
+}
+
+// parseError returns an error at the token for the nonterminal, which expects
+// the terminals of its parse table row
+func (p *LL1Parser) parseError(nt int, pos int, token Token) *ParseError {
+	sym := NewGrammarNonTerm(nt)
+	return &ParseError{
+		pos:      pos,
+		token:    token,
+		nonTerm:  &sym,
+		expected: symsFromSet(p.rowSet(nt), true),
+	}
+}
+
+// Parse parses the tokens. If a token is unexpected, the error is a
+// *ParseError reporting the terminals of the parse table row of the
+// nonterminal being expanded. Expressions of operator tables are parsed by
+// precedence into operator nodes as their operators are consumed.
 func (p *LL1Parser) Parse(tokens []Token) (*ParseTree, error) {
+	return parseLL(tokens, p.start, p.eof, p.exprs, func(nt int, ts *tokenStack) ([]GrammarSym, error) {
+		next, ok := ts.Peek()
+		if !ok {
+			return nil, fmt.Errorf("Unexpected end of token stream: %w", ErrParse)
+		}
+		prod, ok := p.getProduction(nt, next.Kind())
+		if !ok {
+			return nil, p.parseError(nt, ts.Pos(), next)
+		}
+		return prod, nil
+	})
+}
+
+// parseLL parses tokens top down, choosing the production of each
+// nonterminal with predict. Nonterminals of exprs are parsed as expressions
+// of their operator tables.
+func parseLL(tokens []Token, start, eof GrammarSym, exprs map[int]*opGrammar, predict func(nt int, ts *tokenStack) ([]GrammarSym, error)) (*ParseTree, error) {
+	noRecover := func(err error) bool {
+		return false
+	}
 	ts := newTokenStack(tokens)
 	sm := newLL1SymMatcherStack()
 	root := newParseTree(GrammarSym{})
-	sm.Push(newLL1SymMatcher([]GrammarSym{p.start, p.eof}, root))
+	sm.Push(newLL1RootMatcher(start, eof, root))
 	for !sm.Empty() {
 		m, _ := sm.Peek()
 		if m.Done() {
+			if m.expr != nil {
+				wait, err := m.StepExpr(ts, predict, noRecover)
+				if err != nil {
+					return nil, err
+				}
+				if wait {
+					continue
+				}
+			}
 			sm.Pop()
 			continue
 		}
 		sym, _ := m.First()
 		if sym.Term() {
+			pos := ts.Pos()
 			token, ok := ts.Pop()
 			if !ok {
 				return nil, fmt.Errorf("Unexpected end of token stream: %w", ErrParse)
 			}
 			if sym.Kind() != token.Kind() {
-				return nil, fmt.Errorf("Unexpected token: %s: %w", token.Val(), ErrParse)
+				return nil, m.parseError(pos, token)
 			}
 			m.Match(newParseTreeLeaf(sym, token))
 			continue
 		}
-		next, ok := ts.Peek()
-		if !ok {
-			return nil, fmt.Errorf("Unexpected end of token stream: %w", ErrParse)
-		}
-		prod, ok := p.getProduction(sym.Kind(), next.Kind())
-		if !ok {
-			return nil, fmt.Errorf("Unexpected token: %s: %w", next.Val(), ErrParse)
-		}
-		child := newParseTree(sym)
-		m.Match(child)
-		sm.Push(newLL1SymMatcher(prod, child))
-	}
-	rootChildren := root.Children()
-	if len(rootChildren) != 2 {
-		return nil, fmt.Errorf("Unexpected parse tree shape: %w", ErrParseInternal)
-	}
-	lastNode := rootChildren[1]
-	if !lastNode.Term() || lastNode.Sym() != p.eof {
-		return nil, fmt.Errorf("Unexpected parse tree shape: %w", ErrParseInternal)
-	}
-	return rootChildren[0], nil
-}
-
-type (
-	PEGParser struct {
-		rules map[int][][]GrammarSym
-		start GrammarSym
-		eof   GrammarSym
-	}
-
-	pegSymMatcher struct {
-		node   *ParseTree
-		syms   []GrammarSym
-		parent *pegSymMatcher
-		rules  map[int][][]GrammarSym
-	}
-)
-
-func newPEGSymMatcher(node *ParseTree, syms []GrammarSym, parent *pegSymMatcher, rules map[int][][]GrammarSym) *pegSymMatcher {
-	return &pegSymMatcher{
-		node:   node,
-		syms:   syms,
-		parent: parent,
-		rules:  rules,
-	}
-}
-
-func (m *pegSymMatcher) Match(tokens []Token) ([]Token, error) {
-	if len(m.syms) == 0 {
-		if m.parent != nil {
-			return m.parent.Match(tokens)
-		}
-		return tokens, nil
-	}
-	sym := m.syms[0]
-	if sym.Term() {
-		if len(tokens) == 0 {
-			return nil, fmt.Errorf("Unexpected end of token stream: %w", ErrParse)
-		}
-		token := tokens[0]
-		if sym.Kind() != token.Kind() {
-			return nil, fmt.Errorf("Unexpected token: %s: %w", token.Val(), ErrParse)
-		}
-		m.node.addChild(newParseTreeLeaf(sym, token))
-		t, err := newPEGSymMatcher(m.node, m.syms[1:], m.parent, m.rules).Match(tokens[1:])
+		prod, err := predict(sym.Kind(), ts)
 		if err != nil {
-			m.node.popChild()
 			return nil, err
 		}
-		return t, nil
-	}
-	prod, ok := m.rules[sym.Kind()]
-	if !ok {
-		return nil, fmt.Errorf("Nonterminal lacks production rule: %d: %w", sym.Kind(), ErrParse)
-	}
-	for _, i := range prod {
 		child := newParseTree(sym)
-		m.node.addChild(child)
-		if t, err := newPEGSymMatcher(child, i, newPEGSymMatcher(m.node, m.syms[1:], m.parent, m.rules), m.rules).Match(tokens); err == nil {
-			return t, nil
-		}
-		m.node.popChild()
-	}
-	return nil, fmt.Errorf("Exhausted all production rules: %w", ErrParse)
-}
-
-func NewPEGParser(rules []GrammarRule, start, eof GrammarSym) *PEGParser {
-	ruleMap := map[int][][]GrammarSym{}
-	for _, i := range rules {
-		if _, ok := ruleMap[i.from]; !ok {
-			ruleMap[i.from] = [][]GrammarSym{}
+		m.Match(child)
+		if g, ok := exprs[sym.kind]; ok {
+			sm.Push(newLL1ExprMatcher(g, child))
+			continue
 		}
-		ruleMap[i.from] = append(ruleMap[i.from], i.to)
-	}
-
-	return &PEGParser{
-		rules: ruleMap,
-		start: start,
-		eof:   eof,
-	}
-}
-
-func (p *PEGParser) Parse(tokens []Token) (*ParseTree, error) {
-	root := newPEGSymMatcher(newParseTree(GrammarSym{}), []GrammarSym{p.start, p.eof}, nil, p.rules)
-	if _, err := root.Match(tokens); err != nil {
-		return nil, err
+		sm.Push(newLL1SymMatcher(prod, child))
 	}
-	rootChildren := root.node.Children()
+	rootChildren := root.Children()
 	if len(rootChildren) != 2 {
 		return nil, fmt.Errorf("Unexpected parse tree shape: %w", ErrParseInternal)
 	}
 	lastNode := rootChildren[1]
-	if !lastNode.Term() || lastNode.Sym() != p.eof {
+	if !lastNode.Term() || lastNode.Sym() != eof {
 		return nil, fmt.Errorf("Unexpected parse tree shape: %w", ErrParseInternal)
 	}
 	return rootChildren[0], nil
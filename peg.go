@@ -0,0 +1,1194 @@
+package gnom
+
+import (
+	"fmt"
+	"sort"
+)
+
+type (
+	PEGMode int
+
+	// PEGOp is an operator of a parsing expression grammar applied to a
+	// symbol
+	PEGOp int
+
+	// PEGPredicate is a semantic predicate, which is given the partial parse
+	// tree of the nonterminal being matched and the tokens from the position
+	// of the predicate, and returns whether the match may continue
+	PEGPredicate func(node *ParseTree, tokens []Token) bool
+
+	PEGParser struct {
+		rules     map[int][][]GrammarSym
+		leftRec   *changeIntSet
+		preds     map[int]PEGPredicate
+		start     GrammarSym
+		eof       GrammarSym
+		mode      PEGMode
+		memoLimit int
+		maxDepth  int
+		opTables  []*OperatorTable
+		exprs     map[int]*opGrammar
+	}
+
+	PEGParserOpt func(p *PEGParser)
+
+	pegMatch struct {
+		end      int
+		children *pegChildren
+	}
+
+	// pegChildren is a rope of the parse tree nodes of a match, so that
+	// matches are concatenated in constant time
+	pegChildren struct {
+		node  *ParseTree
+		left  *pegChildren
+		right *pegChildren
+	}
+
+	pegMemoKey struct {
+		sym GrammarSym
+		pos int
+	}
+
+	// pegStream holds the matches of a nonterminal or repetition at a
+	// position in the order a backtracking parser would try them, with at
+	// most one match for each end position. Matches are generated only as
+	// they are needed. In strict mode, only the first match is kept.
+	pegStream struct {
+		results []pegMatch
+		ends    map[int]struct{}
+		done    bool
+		active  bool
+		growing bool
+		// seeds holds the matches first found by each iteration of growing
+		// the stream, of which left recursive references reuse the last
+		seeds [][]pegMatch
+		gen   *pegNonTermGen
+		grow  *pegGrowth
+	}
+
+	pegNonTermGen struct {
+		sym  GrammarSym
+		pos  int
+		alt  int
+		seq  *pegSeqCursor
+		expr *pegExprCursor
+	}
+
+	// pegExprCursor matches an expression of an operator table, where pos
+	// is the position of the next operand or operator
+	pegExprCursor struct {
+		op  *opParser
+		pos int
+	}
+
+	// pegGrowth is an iteration of growing a left recursive match
+	pegGrowth struct {
+		gen     *pegNonTermGen
+		results []pegMatch
+		ends    map[int]struct{}
+	}
+
+	// pegSeqCursor enumerates the matches of a sequence of symbols, or of
+	// repetitions of a symbol, depth first. It is resumed at the same symbol
+	// after the matches of a stream it waits on are generated.
+	pegSeqCursor struct {
+		from GrammarSym
+		// top is true for the cursor of the top level sequence, which is not
+		// the production of a nonterminal
+		top     bool
+		syms    []GrammarSym
+		pos     int
+		repeat  bool
+		operand GrammarSym
+		least   int
+		most    int
+		// consume requires repetitions beyond the least number to match at
+		// least one token
+		consume bool
+		yielded bool
+		// cut is the level of the cut matched, or -1
+		cut   int
+		level int
+		idx   []int
+		ends  []int
+		acc   []*pegChildren
+	}
+
+	pegParse struct {
+		p      *PEGParser
+		tokens []Token
+		memo   map[pegMemoKey]*pegStream
+		// failPos is the farthest position at which a terminal failed to
+		// match, and failSet holds the terminals tried there. failNonTerms
+		// holds the nonterminals whose productions tried them, and
+		// failUnknown is true if a repetition or the top level sequence
+		// tried any.
+		failPos      int
+		failSet      map[int]struct{}
+		failNonTerms map[GrammarSym]struct{}
+		failUnknown  bool
+		// cutPos is the position of a cut matched since the last pruning of
+		// the memo, or -1
+		cutPos int
+	}
+)
+
+const (
+	// PEGModeBacktrack tries every match of a nonterminal in order until the
+	// rest of the input matches, which is a depth first search for a
+	// derivation of the input
+	PEGModeBacktrack PEGMode = iota
+	// PEGModeStrict commits to the first match of a nonterminal, which is the
+	// ordered choice of parsing expression grammars
+	PEGModeStrict
+)
+
+const (
+	PEGOpNone PEGOp = iota
+	// PEGOpAnd matches if the symbol matches, without consuming tokens
+	PEGOpAnd
+	// PEGOpNot matches if the symbol does not match, without consuming tokens
+	PEGOpNot
+	// PEGOpZeroOrMore matches the symbol repeatedly
+	PEGOpZeroOrMore
+	// PEGOpOneOrMore matches the symbol repeatedly, at least once
+	PEGOpOneOrMore
+	// PEGOpOptional matches the symbol or nothing
+	PEGOpOptional
+	// PEGOpCut matches nothing, and commits the enclosing nonterminal to the
+	// rule and the matches before it
+	PEGOpCut
+	// PEGOpPredicate matches nothing if a semantic predicate accepts
+	PEGOpPredicate
+)
+
+func newPEGOpSym(sym GrammarSym, op PEGOp) GrammarSym {
+	return GrammarSym{
+		term: sym.term,
+		kind: sym.kind,
+		op:   op,
+	}
+}
+
+// NewPEGAnd returns the and predicate &e of a plain symbol
+func NewPEGAnd(sym GrammarSym) GrammarSym {
+	return newPEGOpSym(sym, PEGOpAnd)
+}
+
+// NewPEGNot returns the not predicate !e of a plain symbol
+func NewPEGNot(sym GrammarSym) GrammarSym {
+	return newPEGOpSym(sym, PEGOpNot)
+}
+
+// NewPEGZeroOrMore returns the repetition e* of a plain symbol, whose matches
+// are added as children of the enclosing node
+func NewPEGZeroOrMore(sym GrammarSym) GrammarSym {
+	return newPEGOpSym(sym, PEGOpZeroOrMore)
+}
+
+// NewPEGOneOrMore returns the repetition e+ of a plain symbol, whose matches
+// are added as children of the enclosing node
+func NewPEGOneOrMore(sym GrammarSym) GrammarSym {
+	return newPEGOpSym(sym, PEGOpOneOrMore)
+}
+
+// NewPEGOptional returns the option e? of a plain symbol, whose match if any
+// is added as a child of the enclosing node
+func NewPEGOptional(sym GrammarSym) GrammarSym {
+	return newPEGOpSym(sym, PEGOpOptional)
+}
+
+// NewPEGCut returns the cut ~. Once the cut is matched, neither earlier
+// symbols of the rule nor later rules of the nonterminal are retried if the
+// rest of the rule fails to match.
+func NewPEGCut() GrammarSym {
+	return GrammarSym{
+		term: true,
+		kind: 0,
+		op:   PEGOpCut,
+	}
+}
+
+// NewPEGPredicate returns the semantic predicate &{kind}, whose function is
+// set by PEGParserPredicate
+func NewPEGPredicate(kind int) GrammarSym {
+	return GrammarSym{
+		term: true,
+		kind: kind,
+		op:   PEGOpPredicate,
+	}
+}
+
+func (s *GrammarSym) PEGOp() PEGOp {
+	return s.op
+}
+
+// pegOperand returns the symbol without its operator
+func pegOperand(sym GrammarSym) GrammarSym {
+	return newPEGOpSym(sym, PEGOpNone)
+}
+
+// pegOptional returns true if the symbol matches regardless of whether its
+// operand matches
+func pegOptional(sym GrammarSym) bool {
+	switch sym.op {
+	case PEGOpNot, PEGOpZeroOrMore, PEGOpOptional:
+		return true
+	default:
+		return false
+	}
+}
+
+// pegControl returns true if the symbol does not match tokens of its kind
+func pegControl(sym GrammarSym) bool {
+	return sym.op == PEGOpCut || sym.op == PEGOpPredicate
+}
+
+func pegNullable(sym GrammarSym, nullableSet *changeIntSet) bool {
+	switch sym.op {
+	case PEGOpAnd, PEGOpNot, PEGOpZeroOrMore, PEGOpOptional, PEGOpCut, PEGOpPredicate:
+		return true
+	}
+	return !sym.term && nullableSet.contains(sym.kind)
+}
+
+// calcPEGLeftCornerSet returns for each nonterminal the nonterminals which
+// may be matched at the same position while matching it
+func calcPEGLeftCornerSet(rules []GrammarRule) *changeIntIntSet {
+	nullableSet := newChangeIntSet()
+	for {
+		nullableSet.resetChanged()
+		for _, i := range rules {
+			nullable := true
+			for _, j := range i.to {
+				if !pegNullable(j, nullableSet) {
+					nullable = false
+					break
+				}
+			}
+			if nullable {
+				nullableSet.upsert(i.from)
+			}
+		}
+		if !nullableSet.isChanged() {
+			break
+		}
+	}
+	set := newChangeIntIntSet()
+	for _, i := range rules {
+		for _, j := range i.to {
+			if !j.term {
+				set.upsert(i.from, j.kind)
+			}
+			if !pegNullable(j, nullableSet) {
+				break
+			}
+		}
+	}
+	for {
+		set.resetChanged()
+		for a, m := range set.set {
+			for b := range m {
+				set.upsertAll(a, set.iter(b))
+			}
+		}
+		if !set.isChanged() {
+			return set
+		}
+	}
+}
+
+func (m PEGMode) String() string {
+	switch m {
+	case PEGModeBacktrack:
+		return "backtrack"
+	case PEGModeStrict:
+		return "strict"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// PEGParserMode sets whether the parser backtracks into nonterminals that
+// have already matched. The default is PEGModeBacktrack.
+func PEGParserMode(mode PEGMode) PEGParserOpt {
+	return func(p *PEGParser) {
+		p.mode = mode
+	}
+}
+
+// PEGParserMemoLimit bounds the number of memoized nonterminal matches. When
+// the limit is exceeded, the matches at the earliest token positions are
+// discarded, and are recomputed if needed again.
+func PEGParserMemoLimit(limit int) PEGParserOpt {
+	return func(p *PEGParser) {
+		p.memoLimit = limit
+	}
+}
+
+// PEGParserMaxDepth bounds the nesting depth of nonterminals and repetitions
+// being matched. Exceeding the depth fails the parse with ErrParse. The
+// default of 0 does not bound the depth.
+func PEGParserMaxDepth(depth int) PEGParserOpt {
+	return func(p *PEGParser) {
+		p.maxDepth = depth
+	}
+}
+
+// PEGParserPredicate sets the function of the semantic predicate of the
+// kind
+func PEGParserPredicate(kind int, pred PEGPredicate) PEGParserOpt {
+	return func(p *PEGParser) {
+		p.preds[kind] = pred
+	}
+}
+
+// PEGParserOperators adds operator tables, each of which defines an
+// expression nonterminal
+func PEGParserOperators(tables ...*OperatorTable) PEGParserOpt {
+	return func(p *PEGParser) {
+		p.opTables = append(p.opTables, tables...)
+	}
+}
+
+// checkPEGLeftRecursion returns the nonterminals which are left recursive
+// only through themselves, and an error if any nonterminals are mutually
+// left recursive
+func checkPEGLeftRecursion(rules []GrammarRule) (*changeIntSet, error) {
+	leftCorner := calcPEGLeftCornerSet(rules)
+	set := newChangeIntSet()
+	mutual := map[int]struct{}{}
+	for a, m := range leftCorner.set {
+		for b := range m {
+			if a == b {
+				set.upsert(a)
+				continue
+			}
+			if _, ok := leftCorner.iter(b)[a]; ok {
+				mutual[a] = struct{}{}
+			}
+		}
+	}
+	if len(mutual) > 0 {
+		return nil, fmt.Errorf("Unsupported indirect left recursion: %v: %w", sortedIntSet(mutual), ErrGrammar)
+	}
+	return set, nil
+}
+
+// NewPEGParser creates a backtracking parser which tries the production
+// rules of a nonterminal in order. Matches of a nonterminal at a token
+// position are memoized. Directly left recursive nonterminals are matched by
+// growing a seed match until it no longer extends. Matching uses an explicit
+// stack rather than recursion, so that the input may be arbitrarily long.
+func NewPEGParser(rules []GrammarRule, start, eof GrammarSym, opts ...PEGParserOpt) (*PEGParser, error) {
+	p := &PEGParser{
+		preds:     map[int]PEGPredicate{},
+		start:     start,
+		eof:       eof,
+		mode:      PEGModeBacktrack,
+		memoLimit: 0,
+		maxDepth:  0,
+		opTables:  []*OperatorTable{},
+	}
+	for _, i := range opts {
+		i(p)
+	}
+	if p.mode != PEGModeBacktrack && p.mode != PEGModeStrict {
+		return nil, fmt.Errorf("Invalid PEG mode: %d: %w", p.mode, ErrGrammar)
+	}
+	// expressions are matched by their operator tables, so the expanded
+	// rules are only used to check the grammar
+	expanded, exprs, err := expandOperatorTables(rules, start, eof, p.opTables)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkPEGGrammarErr(CheckGrammar(expanded, start, eof)); err != nil {
+		return nil, err
+	}
+	leftRec, err := checkPEGLeftRecursion(expanded)
+	if err != nil {
+		return nil, err
+	}
+	ruleMap := map[int][][]GrammarSym{}
+	for _, i := range rules {
+		if _, ok := ruleMap[i.from]; !ok {
+			ruleMap[i.from] = [][]GrammarSym{}
+		}
+		ruleMap[i.from] = append(ruleMap[i.from], i.to)
+		for _, j := range i.to {
+			if j.op != PEGOpPredicate {
+				continue
+			}
+			if _, ok := p.preds[j.kind]; !ok {
+				return nil, fmt.Errorf("Undefined semantic predicate: %d: %w", j.kind, ErrGrammar)
+			}
+		}
+	}
+	p.rules = ruleMap
+	p.leftRec = leftRec
+	p.exprs = exprs
+	return p, nil
+}
+
+func NewPEGParserFromGrammar(g *Grammar, opts ...PEGParserOpt) (*PEGParser, error) {
+	return NewPEGParser(g.rules, g.start, g.eof, opts...)
+}
+
+func newPEGSeqCursor(from GrammarSym, syms []GrammarSym, pos int) *pegSeqCursor {
+	return &pegSeqCursor{
+		from:    from,
+		top:     false,
+		syms:    syms,
+		pos:     pos,
+		repeat:  false,
+		consume: false,
+		yielded: false,
+		cut:     -1,
+		level:   0,
+		idx:     make([]int, len(syms)+1),
+		ends:    make([]int, len(syms)),
+		acc:     make([]*pegChildren, len(syms)),
+	}
+}
+
+// newPEGRepeatCursor creates a cursor over the repetitions of the operand of
+// a repetition symbol, which are tried longest first
+func newPEGRepeatCursor(sym GrammarSym, pos int) *pegSeqCursor {
+	c := &pegSeqCursor{
+		from:    sym,
+		top:     false,
+		syms:    nil,
+		pos:     pos,
+		repeat:  true,
+		operand: pegOperand(sym),
+		least:   0,
+		most:    -1,
+		consume: true,
+		yielded: false,
+		cut:     -1,
+		level:   0,
+		idx:     []int{0},
+		ends:    []int{},
+		acc:     []*pegChildren{},
+	}
+	switch sym.op {
+	case PEGOpOneOrMore:
+		c.least = 1
+	case PEGOpOptional:
+		c.most = 1
+		c.consume = false
+	}
+	return c
+}
+
+func newPEGChildrenLeaf(node *ParseTree) *pegChildren {
+	return &pegChildren{
+		node: node,
+	}
+}
+
+func concatPEGChildren(a, b *pegChildren) *pegChildren {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	return &pegChildren{
+		left:  a,
+		right: b,
+	}
+}
+
+// nodes returns the parse tree nodes of the rope in order
+func (c *pegChildren) nodes() []*ParseTree {
+	nodes := []*ParseTree{}
+	stack := []*pegChildren{}
+	if c != nil {
+		stack = append(stack, c)
+	}
+	for len(stack) > 0 {
+		k := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if k.node != nil {
+			nodes = append(nodes, k.node)
+			continue
+		}
+		stack = append(stack, k.right, k.left)
+	}
+	return nodes
+}
+
+func (p *PEGParser) newParse(tokens []Token) *pegParse {
+	return &pegParse{
+		p:            p,
+		tokens:       tokens,
+		memo:         map[pegMemoKey]*pegStream{},
+		failPos:      -1,
+		failSet:      map[int]struct{}{},
+		failNonTerms: map[GrammarSym]struct{}{},
+		failUnknown:  false,
+		cutPos:       -1,
+	}
+}
+
+// evict discards the inactive memoized matches at the earliest half of the
+// token positions
+func (ps *pegParse) evict() {
+	keys := make([]pegMemoKey, 0, len(ps.memo))
+	for k, v := range ps.memo {
+		if !v.active {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].pos != keys[j].pos {
+			return keys[i].pos < keys[j].pos
+		}
+		if keys[i].sym.kind != keys[j].sym.kind {
+			return keys[i].sym.kind < keys[j].sym.kind
+		}
+		return keys[i].sym.op < keys[j].sym.op
+	})
+	for _, k := range keys[:(len(keys)+1)/2] {
+		delete(ps.memo, k)
+	}
+}
+
+func (ps *pegParse) stream(sym GrammarSym, pos int) *pegStream {
+	k := pegMemoKey{
+		sym: sym,
+		pos: pos,
+	}
+	if s, ok := ps.memo[k]; ok {
+		return s
+	}
+	if ps.p.memoLimit > 0 && len(ps.memo) >= ps.p.memoLimit {
+		ps.evict()
+	}
+	s := &pegStream{
+		results: []pegMatch{},
+		ends:    map[int]struct{}{},
+		done:    false,
+		active:  false,
+		growing: false,
+		gen:     newPEGNonTermGen(sym, pos),
+	}
+	ps.memo[k] = s
+	return s
+}
+
+func newPEGNonTermGen(sym GrammarSym, pos int) *pegNonTermGen {
+	return &pegNonTermGen{
+		sym: sym,
+		pos: pos,
+		alt: 0,
+	}
+}
+
+// get returns the i-th match of the stream if it has been generated, or
+// else the stream to generate further matches of
+func (ps *pegParse) get(s *pegStream, i int) (pegMatch, bool, *pegStream, error) {
+	if s.growing {
+		if k := len(s.seeds); k > 0 && i < len(s.seeds[k-1]) {
+			return s.seeds[k-1][i], true, nil, nil
+		}
+		return pegMatch{}, false, nil, nil
+	}
+	if i < len(s.results) {
+		return s.results[i], true, nil, nil
+	}
+	if s.done {
+		return pegMatch{}, false, nil, nil
+	}
+	if s.active {
+		return pegMatch{}, false, nil, fmt.Errorf("Unexpected left recursion on symbol: %s: %w", s.gen.sym, ErrParseInternal)
+	}
+	return pegMatch{}, false, s, nil
+}
+
+// run generates the next match of the stream, if any. Streams whose matches
+// are needed to generate it are pushed on to an explicit stack.
+func (ps *pegParse) run(s *pegStream) error {
+	stack := []*pegStream{s}
+	s.active = true
+	defer func() {
+		for _, i := range stack {
+			i.active = false
+		}
+	}()
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		wait, done, err := ps.step(top)
+		if err != nil {
+			return err
+		}
+		if wait != nil {
+			if ps.p.maxDepth > 0 && len(stack) >= ps.p.maxDepth {
+				return fmt.Errorf("Exceeded max nesting depth %d at token %d: %w", ps.p.maxDepth, wait.gen.pos, ErrParse)
+			}
+			wait.active = true
+			stack = append(stack, wait)
+			continue
+		}
+		if ps.cutPos >= 0 {
+			ps.prune(stack)
+		}
+		if done {
+			top.active = false
+			stack = stack[:len(stack)-1]
+		}
+	}
+	return nil
+}
+
+// retryPos returns the earliest position at which the stream may match
+// symbols again other than at the position it is currently matching
+func (ps *pegParse) retryPos(s *pegStream) (int, bool) {
+	if s.gen == nil {
+		return 0, false
+	}
+	g := s.gen
+	if s.growing || g.seq == nil {
+		return g.pos, true
+	}
+	if ps.p.mode == PEGModeStrict {
+		// a sequence is not backtracked into in strict mode, as every symbol
+		// has at most one match
+		if g.sym.op == PEGOpNone && g.seq.cut < 0 && g.alt+1 < len(ps.p.rules[g.sym.kind]) {
+			return g.pos, true
+		}
+		return 0, false
+	}
+	if g.seq.cut >= 0 {
+		return g.seq.ends[g.seq.cut], true
+	}
+	return g.pos, true
+}
+
+// prune discards the inactive memoized matches at positions before the last
+// cut which no stream on the stack may match at again
+func (ps *pegParse) prune(stack []*pegStream) {
+	bound := ps.cutPos
+	ps.cutPos = -1
+	for _, i := range stack {
+		if pos, ok := ps.retryPos(i); ok && pos < bound {
+			bound = pos
+		}
+	}
+	for k, v := range ps.memo {
+		if !v.active && k.pos < bound {
+			delete(ps.memo, k)
+		}
+	}
+}
+
+// step advances the generator of the stream once. It returns a stream to
+// wait on, or whether the stream has a new match or is done.
+func (ps *pegParse) step(s *pegStream) (*pegStream, bool, error) {
+	if s.gen.sym.op == PEGOpNone && ps.p.leftRec.contains(s.gen.sym.kind) {
+		return ps.stepGrow(s)
+	}
+	m, ok, wait, err := ps.nextNonTerm(s.gen)
+	if err != nil || wait != nil {
+		return wait, false, err
+	}
+	if !ok {
+		s.done = true
+		s.gen = nil
+		return nil, true, nil
+	}
+	if _, ok := s.ends[m.end]; ok {
+		return nil, false, nil
+	}
+	s.ends[m.end] = struct{}{}
+	s.results = append(s.results, m)
+	if ps.p.mode == PEGModeStrict {
+		s.done = true
+		s.gen = nil
+	}
+	return nil, true, nil
+}
+
+func (ps *pegParse) newGrowth(sym GrammarSym, pos int) *pegGrowth {
+	// repetitions of the nonterminal at the position depend on the matches
+	// of the previous iteration
+	for _, i := range []PEGOp{PEGOpZeroOrMore, PEGOpOneOrMore, PEGOpOptional} {
+		delete(ps.memo, pegMemoKey{
+			sym: newPEGOpSym(sym, i),
+			pos: pos,
+		})
+	}
+	return &pegGrowth{
+		gen:     newPEGNonTermGen(sym, pos),
+		results: []pegMatch{},
+		ends:    map[int]struct{}{},
+	}
+}
+
+// stepGrow advances the matching of a left recursive nonterminal. Each
+// iteration matches the nonterminal again while left recursive references to
+// it reuse only the matches with end positions first found by the previous
+// iteration, since matches grown from earlier ones are already found, until
+// no new end positions are found, or in strict mode, until the match no
+// longer extends further.
+func (ps *pegParse) stepGrow(s *pegStream) (*pegStream, bool, error) {
+	strict := ps.p.mode == PEGModeStrict
+	if s.grow == nil {
+		s.growing = true
+		s.grow = ps.newGrowth(s.gen.sym, s.gen.pos)
+	}
+	g := s.grow
+	m, ok, wait, err := ps.nextNonTerm(g.gen)
+	if err != nil || wait != nil {
+		return wait, false, err
+	}
+	if ok {
+		if _, ok := g.ends[m.end]; ok {
+			return nil, false, nil
+		}
+		g.ends[m.end] = struct{}{}
+		g.results = append(g.results, m)
+		if !strict {
+			return nil, false, nil
+		}
+	}
+	grown := false
+	if strict {
+		grown = len(g.results) > 0 && (len(s.results) == 0 || g.results[0].end > s.results[0].end)
+		if grown {
+			s.results = g.results
+			s.ends = g.ends
+			s.seeds = [][]pegMatch{g.results}
+		}
+	} else {
+		seed := []pegMatch{}
+		for _, i := range g.results {
+			if _, ok := s.ends[i.end]; ok {
+				continue
+			}
+			s.ends[i.end] = struct{}{}
+			seed = append(seed, i)
+		}
+		grown = len(seed) > 0
+		if grown {
+			s.seeds = append(s.seeds, seed)
+		} else {
+			// matches of later iterations are tried first, as they would be
+			// by the last iteration
+			for k := len(s.seeds) - 1; k >= 0; k-- {
+				s.results = append(s.results, s.seeds[k]...)
+			}
+		}
+	}
+	if grown {
+		s.grow = ps.newGrowth(s.gen.sym, s.gen.pos)
+		return nil, false, nil
+	}
+	s.growing = false
+	s.seeds = nil
+	s.done = true
+	s.gen = nil
+	s.grow = nil
+	return nil, true, nil
+}
+
+// nextNonTerm returns the next match of a nonterminal, or of a repetition
+// whose matches are not wrapped in a node
+func (ps *pegParse) nextNonTerm(g *pegNonTermGen) (pegMatch, bool, *pegStream, error) {
+	if g.sym.op != PEGOpNone {
+		if g.alt > 0 {
+			return pegMatch{}, false, nil, nil
+		}
+		if g.seq == nil {
+			g.seq = newPEGRepeatCursor(g.sym, g.pos)
+		}
+		m, ok, wait, err := ps.nextSeq(g.seq)
+		if err != nil || wait != nil || ok {
+			return m, ok, wait, err
+		}
+		g.alt++
+		g.seq = nil
+		return pegMatch{}, false, nil, nil
+	}
+	if og, ok := ps.p.exprs[g.sym.kind]; ok {
+		return ps.nextExpr(g, og)
+	}
+	prods := ps.p.rules[g.sym.kind]
+	for g.alt < len(prods) {
+		if g.seq == nil {
+			g.seq = newPEGSeqCursor(g.sym, prods[g.alt], g.pos)
+		}
+		m, ok, wait, err := ps.nextSeq(g.seq)
+		if err != nil || wait != nil {
+			return pegMatch{}, false, wait, err
+		}
+		if ok {
+			node := newParseTree(NewGrammarNonTerm(g.sym.kind))
+			node.children = m.children.nodes()
+			return pegMatch{
+				end:      m.end,
+				children: newPEGChildrenLeaf(node),
+			}, true, nil, nil
+		}
+		if g.seq.cut >= 0 {
+			g.alt = len(prods)
+		} else {
+			g.alt++
+		}
+		g.seq = nil
+	}
+	return pegMatch{}, false, nil, nil
+}
+
+// nextExpr returns the match of an expression of the operator table, which
+// consumes operators and operands greedily, building the operator nodes by
+// precedence. An expression has at most one match, even in backtrack mode.
+// If an infix operator is not followed by an operand, the expression ends
+// before it, unless it is also a postfix operator.
+func (ps *pegParse) nextExpr(g *pegNonTermGen, og *opGrammar) (pegMatch, bool, *pegStream, error) {
+	if g.alt > 0 {
+		return pegMatch{}, false, nil, nil
+	}
+	if g.expr == nil {
+		g.expr = &pegExprCursor{
+			op:  newOpParser(og),
+			pos: g.pos,
+		}
+	}
+	c := g.expr
+	o := c.op
+	expr := og.table.expr
+	for {
+		var next Token
+		hasNext := c.pos < len(ps.tokens)
+		if hasNext {
+			next = ps.tokens[c.pos]
+		}
+		if o.ExpectOperand() {
+			if op, ok := og.op(OpPrefix, next.Kind()); ok && hasNext {
+				o.Prefix(op, newParseTreeLeaf(op.term, next), c.pos)
+				c.pos++
+				continue
+			}
+			for _, i := range og.terms(OpPrefix) {
+				ps.fail(i, c.pos, &expr)
+			}
+			operand := og.table.operand
+			m, ok, wait, err := ps.sym(operand, c.pos, 0)
+			if err != nil || wait != nil {
+				return pegMatch{}, false, wait, err
+			}
+			if ok {
+				c.pos = m.end
+				if err := o.Operand(m.children.nodes()[0]); err != nil {
+					return pegMatch{}, false, nil, err
+				}
+				continue
+			}
+			if operand.term {
+				ps.fail(operand, c.pos, &expr)
+			}
+			infix, ok := o.Backoff()
+			if o.Empty() {
+				g.alt++
+				g.expr = nil
+				return pegMatch{}, false, nil, nil
+			}
+			if !ok {
+				break
+			}
+			c.pos = infix.pos
+			op, ok := og.op(OpPostfix, infix.op.term.kind)
+			if !ok {
+				break
+			}
+			o.Postfix(op, infix.node)
+			c.pos++
+			continue
+		}
+		if hasNext {
+			if op, ok := og.op(OpInfix, next.Kind()); ok {
+				o.Infix(op, newParseTreeLeaf(op.term, next), c.pos)
+				c.pos++
+				continue
+			}
+			if op, ok := og.op(OpPostfix, next.Kind()); ok {
+				o.Postfix(op, newParseTreeLeaf(op.term, next))
+				c.pos++
+				continue
+			}
+		}
+		for _, i := range og.terms(OpInfix, OpPostfix) {
+			ps.fail(i, c.pos, &expr)
+		}
+		break
+	}
+	g.alt++
+	g.expr = nil
+	return pegMatch{
+		end:      c.pos,
+		children: newPEGChildrenLeaf(o.Tree()),
+	}, true, nil, nil
+}
+
+// sym returns the i-th match of the symbol at the position, or else the
+// stream to generate further matches of
+func (ps *pegParse) sym(sym GrammarSym, pos int, i int) (pegMatch, bool, *pegStream, error) {
+	switch sym.op {
+	case PEGOpAnd, PEGOpNot:
+		if i > 0 {
+			return pegMatch{}, false, nil, nil
+		}
+		operand := pegOperand(sym)
+		var ok bool
+		if operand.term {
+			// a terminal is not expected because a predicate tried it
+			ok = pos < len(ps.tokens) && ps.tokens[pos].Kind() == operand.kind
+		} else {
+			var wait *pegStream
+			var err error
+			_, ok, wait, err = ps.sym(operand, pos, 0)
+			if err != nil || wait != nil {
+				return pegMatch{}, false, wait, err
+			}
+		}
+		if ok != (sym.op == PEGOpAnd) {
+			return pegMatch{}, false, nil, nil
+		}
+		return pegMatch{
+			end:      pos,
+			children: nil,
+		}, true, nil, nil
+	case PEGOpZeroOrMore, PEGOpOneOrMore, PEGOpOptional:
+		return ps.get(ps.stream(sym, pos), i)
+	}
+	if sym.term {
+		if i > 0 {
+			return pegMatch{}, false, nil, nil
+		}
+		if pos >= len(ps.tokens) || ps.tokens[pos].Kind() != sym.kind {
+			return pegMatch{}, false, nil, nil
+		}
+		return pegMatch{
+			end:      pos + 1,
+			children: newPEGChildrenLeaf(newParseTreeLeaf(sym, ps.tokens[pos])),
+		}, true, nil, nil
+	}
+	return ps.get(ps.stream(sym, pos), i)
+}
+
+// fail records a terminal which failed to match at the position in the
+// production of the nonterminal, which is nil if unknown
+func (ps *pegParse) fail(sym GrammarSym, pos int, nonTerm *GrammarSym) {
+	if pos < ps.failPos {
+		return
+	}
+	if pos > ps.failPos {
+		ps.failPos = pos
+		ps.failSet = map[int]struct{}{}
+		ps.failNonTerms = map[GrammarSym]struct{}{}
+		ps.failUnknown = false
+	}
+	ps.failSet[sym.kind] = struct{}{}
+	if nonTerm == nil {
+		ps.failUnknown = true
+	} else {
+		ps.failNonTerms[*nonTerm] = struct{}{}
+	}
+}
+
+// err returns an error at the farthest position at which a terminal failed
+// to match, in the nonterminal whose productions tried every terminal there
+func (ps *pegParse) err() error {
+	if ps.failPos < 0 {
+		return fmt.Errorf("Exhausted all production rules: %w", ErrParse)
+	}
+	var token Token
+	if ps.failPos < len(ps.tokens) {
+		token = ps.tokens[ps.failPos]
+	}
+	var nonTerm *GrammarSym
+	if !ps.failUnknown && len(ps.failNonTerms) == 1 {
+		for k := range ps.failNonTerms {
+			sym := k
+			nonTerm = &sym
+		}
+	}
+	return &ParseError{
+		pos:      ps.failPos,
+		token:    token,
+		nonTerm:  nonTerm,
+		expected: symsFromSet(ps.failSet, true),
+	}
+}
+
+// match returns the matches of the cursor up to the current level
+func (c *pegSeqCursor) match() pegMatch {
+	if c.level == 0 {
+		return pegMatch{
+			end:      c.pos,
+			children: nil,
+		}
+	}
+	return pegMatch{
+		end:      c.ends[c.level-1],
+		children: c.acc[c.level-1],
+	}
+}
+
+// backtrack retries the previous symbol, unless it is at or before a cut
+func (c *pegSeqCursor) backtrack() {
+	c.level--
+	if c.level <= c.cut {
+		c.level = -1
+		return
+	}
+	if c.level >= 0 {
+		c.idx[c.level]++
+	}
+}
+
+// seqSym returns the next match of the symbol at the level of the cursor
+func (ps *pegParse) seqSym(c *pegSeqCursor, sym GrammarSym, pos int) (pegMatch, bool, *pegStream, error) {
+	i := c.idx[c.level]
+	switch sym.op {
+	case PEGOpCut:
+		return pegMatch{
+			end:      pos,
+			children: nil,
+		}, i == 0, nil, nil
+	case PEGOpPredicate:
+		if i > 0 {
+			return pegMatch{}, false, nil, nil
+		}
+		node := newParseTree(c.from)
+		node.children = c.match().children.nodes()
+		if !ps.p.preds[sym.kind](node, ps.tokens[pos:]) {
+			return pegMatch{}, false, nil, nil
+		}
+		return pegMatch{
+			end:      pos,
+			children: nil,
+		}, true, nil, nil
+	default:
+		m, ok, wait, err := ps.sym(sym, pos, i)
+		if !ok && wait == nil && err == nil && i == 0 && sym.term && sym.op == PEGOpNone {
+			ps.fail(sym, pos, c.nonTerm())
+		}
+		return m, ok, wait, err
+	}
+}
+
+// nonTerm returns the nonterminal of the production the cursor matches, or
+// nil for repetitions and the top level sequence
+func (c *pegSeqCursor) nonTerm() *GrammarSym {
+	if c.top || c.repeat {
+		return nil
+	}
+	sym := c.from
+	return &sym
+}
+
+// nextSeq returns the next match of the cursor, backtracking into the last
+// symbol with further matches. If the cursor must wait on the matches of a
+// stream, it returns the stream, and is resumed at the same symbol when
+// called again.
+func (ps *pegParse) nextSeq(c *pegSeqCursor) (pegMatch, bool, *pegStream, error) {
+	if c.yielded {
+		c.yielded = false
+		c.backtrack()
+	}
+	for c.level >= 0 {
+		if (!c.repeat && c.level == len(c.syms)) || (c.repeat && c.level == c.most) {
+			c.yielded = true
+			return c.match(), true, nil, nil
+		}
+		sym := c.operand
+		if !c.repeat {
+			sym = c.syms[c.level]
+		}
+		pos := c.match().end
+		m, ok, wait, err := ps.seqSym(c, sym, pos)
+		if err != nil || wait != nil {
+			return pegMatch{}, false, wait, err
+		}
+		if ok && c.consume && c.level >= c.least && m.end == pos {
+			c.idx[c.level]++
+			continue
+		}
+		if ok {
+			if sym.op == PEGOpCut {
+				c.cut = c.level
+				ps.cutPos = pos
+			}
+			acc := concatPEGChildren(c.match().children, m.children)
+			if c.level == len(c.ends) {
+				c.ends = append(c.ends, m.end)
+				c.acc = append(c.acc, acc)
+				c.idx = append(c.idx, 0)
+			} else {
+				c.ends[c.level] = m.end
+				c.acc[c.level] = acc
+			}
+			c.level++
+			c.idx[c.level] = 0
+			continue
+		}
+		if c.repeat && c.level >= c.least {
+			c.yielded = true
+			return c.match(), true, nil, nil
+		}
+		if ps.p.mode == PEGModeStrict {
+			// earlier symbols have no further matches
+			c.level = -1
+			break
+		}
+		c.backtrack()
+	}
+	return pegMatch{}, false, nil, nil
+}
+
+// match returns the first match of the sequence of symbols from the start
+// of the tokens
+func (ps *pegParse) match(syms []GrammarSym) (pegMatch, bool, error) {
+	c := newPEGSeqCursor(GrammarSym{}, syms, 0)
+	c.top = true
+	for {
+		m, ok, wait, err := ps.nextSeq(c)
+		if err != nil {
+			return pegMatch{}, false, err
+		}
+		if wait == nil {
+			return m, ok, nil
+		}
+		if err := ps.run(wait); err != nil {
+			return pegMatch{}, false, err
+		}
+	}
+}
+
+// Parse parses the tokens. If the tokens do not match, the error is a
+// *ParseError at the farthest token any terminal was tried at, reporting the
+// terminals tried there. Expressions of operator tables are parsed by
+// precedence into operator nodes as their operators are matched.
+func (p *PEGParser) Parse(tokens []Token) (*ParseTree, error) {
+	ps := p.newParse(tokens)
+	m, ok, err := ps.match([]GrammarSym{p.start, p.eof})
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ps.err()
+	}
+	children := m.children.nodes()
+	if len(children) != 2 {
+		return nil, fmt.Errorf("Unexpected parse tree shape: %w", ErrParseInternal)
+	}
+	lastNode := children[1]
+	if !lastNode.Term() || lastNode.Sym() != p.eof {
+		return nil, fmt.Errorf("Unexpected parse tree shape: %w", ErrParseInternal)
+	}
+	return children[0], nil
+}
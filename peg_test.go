@@ -0,0 +1,1086 @@
+package gnom
+
+import (
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestPEGParser_Parse(t *testing.T) {
+	assert := assert.New(t)
+
+	g := NewGrammarSymGenerator()
+
+	def := g.Term()
+	eof := g.Term()
+	wspace := g.Term()
+	S := g.NonTerm()
+
+	T := g.NonTerm()
+	SP := g.NonTerm()
+	TP := g.NonTerm()
+	F := g.NonTerm()
+	num := g.Term()
+	plus := g.Term()
+	star := g.Term()
+	lparen := g.Term()
+	rparen := g.Term()
+
+	dfa := NewDfa(def.Kind())
+	wspaceNode := NewDfa(wspace.Kind())
+	dfa.AddDfa([]rune(" "), wspaceNode)
+	wspaceNode.AddDfa([]rune(" "), wspaceNode)
+	numNode := NewDfa(num.Kind())
+	dfa.AddDfa([]rune("0123456789"), numNode)
+	numNode.AddDfa([]rune("0123456789"), numNode)
+	dfa.AddPath([]rune("+"), plus.Kind(), def.Kind())
+	dfa.AddPath([]rune("*"), star.Kind(), def.Kind())
+	dfa.AddPath([]rune("("), lparen.Kind(), def.Kind())
+	dfa.AddPath([]rune(")"), rparen.Kind(), def.Kind())
+	lexer := NewDfaLexer(dfa, def.Kind(), eof.Kind(), map[int]struct{}{
+		wspace.Kind(): {},
+	})
+
+	parser, err := NewPEGParser([]GrammarRule{
+		NewGrammarRule(S, T, SP),
+		NewGrammarRule(SP, plus, T, SP),
+		NewGrammarRule(SP),
+		NewGrammarRule(T, F, TP),
+		NewGrammarRule(TP, star, F, TP),
+		NewGrammarRule(TP),
+		NewGrammarRule(F, num),
+		NewGrammarRule(F, lparen, S, rparen),
+	}, S, eof)
+	assert.NoErrorf(err, "Failed to create parser: %v", err)
+
+	var evalTree func(node *ParseTree) (int, error)
+	evalTree = func(node *ParseTree) (int, error) {
+		if node.Term() {
+			if node.Kind() == num.Kind() {
+				v, err := strconv.Atoi(node.Val())
+				if err != nil {
+					return 0, err
+				}
+				return v, nil
+			}
+			return 0, fmt.Errorf("Cannot eval")
+		}
+		children := node.Children()
+		switch node.Kind() {
+		case S.Kind():
+			v1, err := evalTree(children[0])
+			if err != nil {
+				return 0, err
+			}
+			v2, err := evalTree(children[1])
+			if err != nil {
+				return 0, err
+			}
+			return v1 + v2, nil
+		case SP.Kind():
+			if len(children) == 0 {
+				return 0, nil
+			}
+			v1, err := evalTree(children[1])
+			if err != nil {
+				return 0, err
+			}
+			v2, err := evalTree(children[2])
+			if err != nil {
+				return 0, err
+			}
+			return v1 + v2, nil
+		case T.Kind():
+			v1, err := evalTree(children[0])
+			if err != nil {
+				return 0, err
+			}
+			v2, err := evalTree(children[1])
+			if err != nil {
+				return 0, err
+			}
+			return v1 * v2, nil
+		case TP.Kind():
+			if len(children) == 0 {
+				return 1, nil
+			}
+			v1, err := evalTree(children[1])
+			if err != nil {
+				return 0, err
+			}
+			v2, err := evalTree(children[2])
+			if err != nil {
+				return 0, err
+			}
+			return v1 * v2, nil
+		case F.Kind():
+			if len(children) == 1 {
+				return evalTree(children[0])
+			}
+			return evalTree(children[1])
+		default:
+			return 0, fmt.Errorf("Cannot eval")
+		}
+	}
+
+	for _, c := range []struct {
+		text string
+		err  error
+		exp  int
+	}{
+		{
+			text: "1 + 2 + 3",
+			exp:  6,
+		},
+		{
+			text: "3 * 2 + 3",
+			exp:  9,
+		},
+		{
+			text: "3 * (2 + 3)",
+			exp:  15,
+		},
+	} {
+		tokens, err := lexer.Tokenize([]rune(c.text))
+		assert.NoErrorf(err, "Failed to tokenize %s: %v", c.text, err)
+		tree, err := parser.Parse(tokens)
+		if c.err != nil {
+			assert.Errorf(err, "Should fail to parse %s", c.text)
+			assert.Truef(errors.Is(err, c.err), "Should fail to parse %s", c.text)
+			continue
+		}
+		assert.NoErrorf(err, "Failed to parse %s: %v", c.text, err)
+		v, err := evalTree(tree)
+		assert.NoErrorf(err, "Failed to eval %s: %v", c.text, err)
+		assert.Equal(c.exp, v)
+	}
+}
+
+func TestPEGParser_Memo(t *testing.T) {
+	assert := assert.New(t)
+
+	g := NewGrammarSymGenerator()
+
+	S := g.NonTerm()
+	eof := g.Term()
+	x := g.Term()
+	y := g.Term()
+	z := g.Term()
+
+	// each level tries x before y, so that without memoization the input
+	// z y y ... y is matched in time exponential in the number of levels
+	const depth = 24
+	levels := make([]GrammarSym, 0, depth+1)
+	levels = append(levels, S)
+	for i := 0; i < depth; i++ {
+		levels = append(levels, g.NonTerm())
+	}
+	rules := []GrammarRule{}
+	for i := 0; i < depth; i++ {
+		rules = append(rules,
+			NewGrammarRule(levels[i], levels[i+1], x),
+			NewGrammarRule(levels[i], levels[i+1], y),
+		)
+	}
+	rules = append(rules, NewGrammarRule(levels[depth], z))
+
+	tokens := []Token{newToken(z.Kind(), "z")}
+	for i := 0; i < depth; i++ {
+		tokens = append(tokens, newToken(y.Kind(), "y"))
+	}
+	tokens = append(tokens, newToken(eof.Kind(), ""))
+
+	for n, c := range []struct {
+		limit int
+	}{
+		{
+			limit: 0,
+		},
+		{
+			limit: 8,
+		},
+	} {
+		parser, err := NewPEGParser(rules, S, eof, PEGParserMemoLimit(c.limit))
+		assert.NoErrorf(err, "Failed to create parser: case %d", n)
+		ps := parser.newParse(tokens)
+		m, ok, err := ps.match([]GrammarSym{S, eof})
+		assert.NoErrorf(err, "Failed to parse: case %d", n)
+		assert.Truef(ok, "Failed to parse: case %d", n)
+		assert.Equalf(len(tokens), m.end, "Fail case %d", n)
+		_, ok = checkParseTree(rules, m.children.nodes()[0])
+		assert.Truef(ok, "Invalid parse tree: case %d", n)
+		if c.limit == 0 {
+			assert.Equalf(depth+1, len(ps.memo), "Each level should be matched once: case %d", n)
+		}
+	}
+
+	{
+		// a wide sequence keeps few nonterminals active
+		X := g.NonTerm()
+		seq := []GrammarSym{}
+		tokens := []Token{}
+		for i := 0; i < 16; i++ {
+			seq = append(seq, X)
+			tokens = append(tokens, newToken(y.Kind(), "y"))
+		}
+		tokens = append(tokens, newToken(eof.Kind(), ""))
+		rules := []GrammarRule{
+			NewGrammarRule(S, seq...),
+			NewGrammarRule(X, x),
+			NewGrammarRule(X, y),
+		}
+		parser, err := NewPEGParser(rules, S, eof, PEGParserMemoLimit(8))
+		assert.NoError(err, "Failed to create parser")
+		ps := parser.newParse(tokens)
+		m, ok, err := ps.match([]GrammarSym{S, eof})
+		assert.NoError(err, "Failed to parse")
+		assert.True(ok, "Failed to parse")
+		assert.Equal(len(tokens), m.end)
+		assert.LessOrEqual(len(ps.memo), 8, "Memo exceeds limit")
+	}
+}
+
+func TestPEGParser_LeftRecursion(t *testing.T) {
+	assert := assert.New(t)
+
+	g := NewGrammarSymGenerator()
+
+	E := g.NonTerm()
+	eof := g.Term()
+
+	T := g.NonTerm()
+	F := g.NonTerm()
+	num := g.Term()
+	plus := g.Term()
+	star := g.Term()
+	lparen := g.Term()
+	rparen := g.Term()
+	A := g.NonTerm()
+	B := g.NonTerm()
+	a := g.Term()
+	b := g.Term()
+
+	for n, c := range []struct {
+		rules  []GrammarRule
+		start  GrammarSym
+		tokens []Token
+		exp    string
+		err    error
+	}{
+		{
+			rules: []GrammarRule{
+				NewGrammarRule(E, E, plus, T),
+				NewGrammarRule(E, T),
+				NewGrammarRule(T, T, star, F),
+				NewGrammarRule(T, F),
+				NewGrammarRule(F, num),
+				NewGrammarRule(F, lparen, E, rparen),
+			},
+			start: E,
+			tokens: []Token{
+				newToken(num.Kind(), "1"),
+				newToken(plus.Kind(), "+"),
+				newToken(num.Kind(), "2"),
+				newToken(star.Kind(), "*"),
+				newToken(num.Kind(), "3"),
+				newToken(star.Kind(), "*"),
+				newToken(lparen.Kind(), "("),
+				newToken(num.Kind(), "4"),
+				newToken(plus.Kind(), "+"),
+				newToken(num.Kind(), "5"),
+				newToken(rparen.Kind(), ")"),
+				newToken(plus.Kind(), "+"),
+				newToken(num.Kind(), "6"),
+				newToken(eof.Kind(), ""),
+			},
+			exp: "0(0(0(2(3(1))) + 2(2(2(3(2)) * 3(3)) * 3(( 0(0(2(3(4))) + 2(3(5))) )))) + 2(3(6)))",
+		},
+		{
+			// left recursion through a nullable prefix
+			rules: []GrammarRule{
+				NewGrammarRule(E, A, E, b),
+				NewGrammarRule(E, a),
+				NewGrammarRule(A),
+			},
+			start: E,
+			tokens: []Token{
+				newToken(a.Kind(), "a"),
+				newToken(b.Kind(), "b"),
+				newToken(b.Kind(), "b"),
+				newToken(eof.Kind(), ""),
+			},
+			exp: "0(9() 0(9() 0(a) b) b)",
+		},
+		{
+			rules: []GrammarRule{
+				NewGrammarRule(E, E, a),
+				NewGrammarRule(E, E, b),
+				NewGrammarRule(E),
+			},
+			start: E,
+			tokens: []Token{
+				newToken(a.Kind(), "a"),
+				newToken(b.Kind(), "b"),
+				newToken(a.Kind(), "a"),
+				newToken(eof.Kind(), ""),
+			},
+			exp: "0(0(0(0() a) b) a)",
+		},
+		{
+			rules: []GrammarRule{
+				NewGrammarRule(E, A, a),
+				NewGrammarRule(A, B, b),
+				NewGrammarRule(A, a),
+				NewGrammarRule(B, E, b),
+			},
+			start: E,
+			err:   ErrGrammar,
+		},
+	} {
+		parser, err := NewPEGParser(c.rules, c.start, eof)
+		if c.err != nil {
+			assert.Errorf(err, "Should fail to create parser: case %d", n)
+			assert.Truef(errors.Is(err, c.err), "Should fail to create parser: case %d", n)
+			continue
+		}
+		assert.NoErrorf(err, "Failed to create parser: case %d, %v", n, err)
+		tree, err := parser.Parse(c.tokens)
+		assert.NoErrorf(err, "Failed to parse: case %d, %v", n, err)
+		assert.Equalf(c.exp, parseTreeString(tree), "Fail case %d", n)
+	}
+
+	const length = 5000
+	tokens := make([]Token, 0, length+1)
+	for i := 0; i < length; i++ {
+		tokens = append(tokens, newToken(a.Kind(), "a"))
+	}
+	tokens = append(tokens, newToken(eof.Kind(), ""))
+	for _, mode := range []PEGMode{PEGModeBacktrack, PEGModeStrict} {
+		parser, err := NewPEGParser([]GrammarRule{
+			NewGrammarRule(E, E, a),
+			NewGrammarRule(E, a),
+		}, E, eof, PEGParserMode(mode))
+		assert.NoErrorf(err, "Failed to create parser: %s", mode)
+		start := time.Now()
+		tree, err := parser.Parse(tokens)
+		assert.NoErrorf(err, "Failed to parse: %s, %v", mode, err)
+		assert.Truef(time.Since(start) < 2*time.Second, "Growing a seed should be linear in the input: %s", mode)
+		depth := 0
+		for node := tree; len(node.Children()) > 1; node = node.Children()[0] {
+			depth++
+		}
+		assert.Equalf(length-1, depth, "Fail %s", mode)
+	}
+}
+
+func TestPEGParser_Mode(t *testing.T) {
+	assert := assert.New(t)
+
+	g := NewGrammarSymGenerator()
+
+	S := g.NonTerm()
+	eof := g.Term()
+
+	A := g.NonTerm()
+	E := g.NonTerm()
+	a := g.Term()
+	b := g.Term()
+	num := g.Term()
+	plus := g.Term()
+
+	for n, c := range []struct {
+		rules     []GrammarRule
+		tokens    []Token
+		backtrack string
+		strict    string
+	}{
+		{
+			// a greedy match of A is not retried with fewer tokens
+			rules: []GrammarRule{
+				NewGrammarRule(S, A, a),
+				NewGrammarRule(A, a, a),
+				NewGrammarRule(A, a),
+			},
+			tokens: []Token{
+				newToken(a.Kind(), "a"),
+				newToken(a.Kind(), "a"),
+				newToken(eof.Kind(), ""),
+			},
+			backtrack: "0(2(a) a)",
+		},
+		{
+			// the first alternative to match is committed to even when a later
+			// one would match more input
+			rules: []GrammarRule{
+				NewGrammarRule(S, A),
+				NewGrammarRule(A, a),
+				NewGrammarRule(A, a, b),
+			},
+			tokens: []Token{
+				newToken(a.Kind(), "a"),
+				newToken(b.Kind(), "b"),
+				newToken(eof.Kind(), ""),
+			},
+			backtrack: "0(2(a b))",
+		},
+		{
+			// ordering alternatives longest first matches in both modes
+			rules: []GrammarRule{
+				NewGrammarRule(S, A),
+				NewGrammarRule(A, a, b),
+				NewGrammarRule(A, a),
+			},
+			tokens: []Token{
+				newToken(a.Kind(), "a"),
+				newToken(b.Kind(), "b"),
+				newToken(eof.Kind(), ""),
+			},
+			backtrack: "0(2(a b))",
+			strict:    "0(2(a b))",
+		},
+		{
+			rules: []GrammarRule{
+				NewGrammarRule(S, E),
+				NewGrammarRule(E, E, plus, num),
+				NewGrammarRule(E, num),
+			},
+			tokens: []Token{
+				newToken(num.Kind(), "1"),
+				newToken(plus.Kind(), "+"),
+				newToken(num.Kind(), "2"),
+				newToken(plus.Kind(), "+"),
+				newToken(num.Kind(), "3"),
+				newToken(eof.Kind(), ""),
+			},
+			backtrack: "0(3(3(3(1) + 2) + 3))",
+			strict:    "0(3(3(3(1) + 2) + 3))",
+		},
+		{
+			// a left recursive match is grown as far as possible, and is not
+			// retried shorter in strict mode
+			rules: []GrammarRule{
+				NewGrammarRule(S, E, plus),
+				NewGrammarRule(E, E, plus),
+				NewGrammarRule(E, num),
+			},
+			tokens: []Token{
+				newToken(num.Kind(), "1"),
+				newToken(plus.Kind(), "+"),
+				newToken(plus.Kind(), "+"),
+				newToken(eof.Kind(), ""),
+			},
+			backtrack: "0(3(3(1) +) +)",
+		},
+	} {
+		for _, mode := range []PEGMode{PEGModeBacktrack, PEGModeStrict} {
+			exp := c.backtrack
+			if mode == PEGModeStrict {
+				exp = c.strict
+			}
+			parser, err := NewPEGParser(c.rules, S, eof, PEGParserMode(mode))
+			assert.NoErrorf(err, "Failed to create parser: %s case %d", mode, n)
+			tree, err := parser.Parse(c.tokens)
+			if exp == "" {
+				assert.Errorf(err, "Should fail to parse: %s case %d", mode, n)
+				assert.Truef(errors.Is(err, ErrParse), "Should fail to parse: %s case %d", mode, n)
+				continue
+			}
+			assert.NoErrorf(err, "Failed to parse: %s case %d, %v", mode, n, err)
+			assert.Equalf(exp, parseTreeString(tree), "Fail %s case %d", mode, n)
+		}
+	}
+
+	_, err := NewPEGParser([]GrammarRule{
+		NewGrammarRule(S, a),
+	}, S, eof, PEGParserMode(PEGMode(-1)))
+	assert.True(errors.Is(err, ErrGrammar), "Invalid mode should fail")
+}
+
+func TestPEGParser_Operators(t *testing.T) {
+	assert := assert.New(t)
+
+	g := NewGrammarSymGenerator()
+
+	S := g.NonTerm()
+	eof := g.Term()
+
+	A := g.NonTerm()
+	a := g.Term()
+	b := g.Term()
+
+	for n, c := range []struct {
+		rules     []GrammarRule
+		tokens    []Token
+		backtrack string
+		strict    string
+	}{
+		{
+			// repetitions add their matches as children of the enclosing node
+			rules: []GrammarRule{
+				NewGrammarRule(S, NewPEGZeroOrMore(a), b),
+			},
+			tokens: []Token{
+				newToken(a.Kind(), "a"),
+				newToken(a.Kind(), "a"),
+				newToken(b.Kind(), "b"),
+				newToken(eof.Kind(), ""),
+			},
+			backtrack: "0(a a b)",
+			strict:    "0(a a b)",
+		},
+		{
+			rules: []GrammarRule{
+				NewGrammarRule(S, NewPEGZeroOrMore(a), b),
+			},
+			tokens: []Token{
+				newToken(b.Kind(), "b"),
+				newToken(eof.Kind(), ""),
+			},
+			backtrack: "0(b)",
+			strict:    "0(b)",
+		},
+		{
+			rules: []GrammarRule{
+				NewGrammarRule(S, NewPEGOneOrMore(A)),
+				NewGrammarRule(A, a),
+			},
+			tokens: []Token{
+				newToken(a.Kind(), "a"),
+				newToken(a.Kind(), "a"),
+				newToken(eof.Kind(), ""),
+			},
+			backtrack: "0(2(a) 2(a))",
+			strict:    "0(2(a) 2(a))",
+		},
+		{
+			rules: []GrammarRule{
+				NewGrammarRule(S, NewPEGOneOrMore(A)),
+				NewGrammarRule(A, a),
+			},
+			tokens: []Token{
+				newToken(eof.Kind(), ""),
+			},
+		},
+		{
+			// a greedy repetition gives back matches only when backtracking
+			rules: []GrammarRule{
+				NewGrammarRule(S, NewPEGZeroOrMore(a), a),
+			},
+			tokens: []Token{
+				newToken(a.Kind(), "a"),
+				newToken(a.Kind(), "a"),
+				newToken(eof.Kind(), ""),
+			},
+			backtrack: "0(a a)",
+		},
+		{
+			rules: []GrammarRule{
+				NewGrammarRule(S, NewPEGOptional(a), b),
+			},
+			tokens: []Token{
+				newToken(a.Kind(), "a"),
+				newToken(b.Kind(), "b"),
+				newToken(eof.Kind(), ""),
+			},
+			backtrack: "0(a b)",
+			strict:    "0(a b)",
+		},
+		{
+			rules: []GrammarRule{
+				NewGrammarRule(S, NewPEGOptional(a), b),
+			},
+			tokens: []Token{
+				newToken(b.Kind(), "b"),
+				newToken(eof.Kind(), ""),
+			},
+			backtrack: "0(b)",
+			strict:    "0(b)",
+		},
+		{
+			// a repetition stops at a match which consumes no tokens
+			rules: []GrammarRule{
+				NewGrammarRule(S, NewPEGZeroOrMore(A)),
+				NewGrammarRule(A, NewPEGOptional(a)),
+			},
+			tokens: []Token{
+				newToken(a.Kind(), "a"),
+				newToken(a.Kind(), "a"),
+				newToken(eof.Kind(), ""),
+			},
+			backtrack: "0(2(a) 2(a))",
+			strict:    "0(2(a) 2(a))",
+		},
+		{
+			// predicates consume no tokens and add no children
+			rules: []GrammarRule{
+				NewGrammarRule(S, NewPEGAnd(A), A),
+				NewGrammarRule(A, a),
+			},
+			tokens: []Token{
+				newToken(a.Kind(), "a"),
+				newToken(eof.Kind(), ""),
+			},
+			backtrack: "0(2(a))",
+			strict:    "0(2(a))",
+		},
+		{
+			rules: []GrammarRule{
+				NewGrammarRule(S, NewPEGAnd(b), A),
+				NewGrammarRule(A, a),
+			},
+			tokens: []Token{
+				newToken(a.Kind(), "a"),
+				newToken(eof.Kind(), ""),
+			},
+		},
+		{
+			rules: []GrammarRule{
+				NewGrammarRule(S, NewPEGNot(b), NewPEGZeroOrMore(a)),
+			},
+			tokens: []Token{
+				newToken(a.Kind(), "a"),
+				newToken(eof.Kind(), ""),
+			},
+			backtrack: "0(a)",
+			strict:    "0(a)",
+		},
+		{
+			rules: []GrammarRule{
+				NewGrammarRule(S, NewPEGNot(a), NewPEGZeroOrMore(a)),
+			},
+			tokens: []Token{
+				newToken(a.Kind(), "a"),
+				newToken(eof.Kind(), ""),
+			},
+		},
+		{
+			// a match of everything before the end of the token stream
+			rules: []GrammarRule{
+				NewGrammarRule(S, NewPEGZeroOrMore(A)),
+				NewGrammarRule(A, NewPEGNot(eof), NewPEGOptional(a), NewPEGOptional(b)),
+			},
+			tokens: []Token{
+				newToken(a.Kind(), "a"),
+				newToken(b.Kind(), "b"),
+				newToken(b.Kind(), "b"),
+				newToken(eof.Kind(), ""),
+			},
+			backtrack: "0(2(a b) 2(b))",
+			strict:    "0(2(a b) 2(b))",
+		},
+	} {
+		for _, mode := range []PEGMode{PEGModeBacktrack, PEGModeStrict} {
+			exp := c.backtrack
+			if mode == PEGModeStrict {
+				exp = c.strict
+			}
+			parser, err := NewPEGParser(c.rules, S, eof, PEGParserMode(mode))
+			assert.NoErrorf(err, "Failed to create parser: %s case %d", mode, n)
+			tree, err := parser.Parse(c.tokens)
+			if exp == "" {
+				assert.Errorf(err, "Should fail to parse: %s case %d", mode, n)
+				assert.Truef(errors.Is(err, ErrParse), "Should fail to parse: %s case %d", mode, n)
+				continue
+			}
+			assert.NoErrorf(err, "Failed to parse: %s case %d, %v", mode, n, err)
+			assert.Equalf(exp, parseTreeString(tree), "Fail %s case %d", mode, n)
+		}
+	}
+
+	_, err := NewLL1Parser([]GrammarRule{
+		NewGrammarRule(S, NewPEGZeroOrMore(a)),
+	}, S, eof)
+	assert.True(errors.Is(err, ErrGrammar), "PEG operators should be rejected by other parsers")
+
+	_, err = NewPEGParser([]GrammarRule{
+		NewGrammarRule(S, NewPEGOptional(a), S, b),
+		NewGrammarRule(S, b),
+	}, S, eof)
+	assert.NoError(err, "Left recursion through an optional symbol should be supported")
+}
+
+func TestPEGParser_Depth(t *testing.T) {
+	assert := assert.New(t)
+
+	g := NewGrammarSymGenerator()
+
+	S := g.NonTerm()
+	eof := g.Term()
+
+	L := g.NonTerm()
+	a := g.Term()
+
+	const length = 50000
+	tokens := make([]Token, 0, length+1)
+	for i := 0; i < length; i++ {
+		tokens = append(tokens, newToken(a.Kind(), "a"))
+	}
+	tokens = append(tokens, newToken(eof.Kind(), ""))
+
+	for _, mode := range []PEGMode{PEGModeBacktrack, PEGModeStrict} {
+		{
+			parser, err := NewPEGParser([]GrammarRule{
+				NewGrammarRule(S, NewPEGZeroOrMore(a)),
+			}, S, eof, PEGParserMode(mode), PEGParserMaxDepth(8))
+			assert.NoErrorf(err, "Failed to create parser: %s", mode)
+			tree, err := parser.Parse(tokens)
+			assert.NoErrorf(err, "Failed to parse: %s, %v", mode, err)
+			assert.Lenf(tree.Children(), length, "A repetition should not nest: %s", mode)
+		}
+		{
+			rules := []GrammarRule{
+				NewGrammarRule(S, L),
+				NewGrammarRule(L, a, L),
+				NewGrammarRule(L),
+			}
+			parser, err := NewPEGParser(rules, S, eof, PEGParserMode(mode))
+			assert.NoErrorf(err, "Failed to create parser: %s", mode)
+			tree, err := parser.Parse(tokens)
+			assert.NoErrorf(err, "Failed to parse: %s, %v", mode, err)
+			depth := 0
+			for node := tree.Children()[0]; len(node.Children()) > 0; node = node.Children()[1] {
+				depth++
+			}
+			assert.Equalf(length, depth, "Fail %s", mode)
+
+			parser, err = NewPEGParser(rules, S, eof, PEGParserMode(mode), PEGParserMaxDepth(100))
+			assert.NoErrorf(err, "Failed to create parser: %s", mode)
+			_, err = parser.Parse(tokens)
+			assert.Errorf(err, "Should exceed max depth: %s", mode)
+			assert.Truef(errors.Is(err, ErrParse), "Should exceed max depth: %s", mode)
+			_, err = parser.Parse(tokens[length-50:])
+			assert.NoErrorf(err, "Failed to parse: %s, %v", mode, err)
+		}
+	}
+}
+
+func TestPEGParser_Error(t *testing.T) {
+	assert := assert.New(t)
+
+	g := NewGrammarSymGenerator()
+
+	S := g.NonTerm()
+	eof := g.Term()
+
+	A := g.NonTerm()
+	a := g.Term()
+	b := g.Term()
+	c := g.Term()
+	d := g.Term()
+
+	for n, tc := range []struct {
+		rules   []GrammarRule
+		tokens  []Token
+		pos     int
+		nonTerm *GrammarSym
+		expect  []GrammarSym
+	}{
+		{
+			rules: []GrammarRule{
+				NewGrammarRule(S, A, b),
+				NewGrammarRule(S, A, c),
+				NewGrammarRule(A, a),
+			},
+			tokens: []Token{
+				newToken(a.Kind(), "a"),
+				newToken(d.Kind(), "d"),
+				newToken(eof.Kind(), ""),
+			},
+			pos:     1,
+			nonTerm: &S,
+			expect:  []GrammarSym{b, c},
+		},
+		{
+			rules: []GrammarRule{
+				NewGrammarRule(S, a),
+			},
+			tokens: []Token{
+				newToken(a.Kind(), "a"),
+				newToken(a.Kind(), "a"),
+				newToken(eof.Kind(), ""),
+			},
+			pos:     1,
+			nonTerm: nil,
+			expect:  []GrammarSym{eof},
+		},
+		{
+			// only the terminals at the farthest position are expected
+			rules: []GrammarRule{
+				NewGrammarRule(S, a, b, c),
+				NewGrammarRule(S, a, d),
+			},
+			tokens: []Token{
+				newToken(a.Kind(), "a"),
+				newToken(b.Kind(), "b"),
+				newToken(a.Kind(), "a"),
+				newToken(eof.Kind(), ""),
+			},
+			pos:     2,
+			nonTerm: &S,
+			expect:  []GrammarSym{c},
+		},
+		{
+			// terminals tried by a predicate are not expected
+			rules: []GrammarRule{
+				NewGrammarRule(S, NewPEGNot(b), a),
+				NewGrammarRule(S, b, c),
+			},
+			tokens: []Token{
+				newToken(b.Kind(), "b"),
+				newToken(d.Kind(), "d"),
+				newToken(eof.Kind(), ""),
+			},
+			pos:     1,
+			nonTerm: &S,
+			expect:  []GrammarSym{c},
+		},
+		{
+			rules: []GrammarRule{
+				NewGrammarRule(S, NewPEGZeroOrMore(A), d),
+				NewGrammarRule(A, a, b),
+			},
+			tokens: []Token{
+				newToken(a.Kind(), "a"),
+				newToken(b.Kind(), "b"),
+				newToken(c.Kind(), "c"),
+				newToken(eof.Kind(), ""),
+			},
+			pos:     2,
+			nonTerm: nil,
+			expect:  []GrammarSym{a, d},
+		},
+	} {
+		for _, mode := range []PEGMode{PEGModeBacktrack, PEGModeStrict} {
+			parser, err := NewPEGParser(tc.rules, S, eof, PEGParserMode(mode))
+			assert.NoErrorf(err, "Failed to create parser: %s case %d", mode, n)
+			_, err = parser.Parse(tc.tokens)
+			assert.Errorf(err, "Should fail to parse: %s case %d", mode, n)
+			assert.Truef(errors.Is(err, ErrParse), "Should fail to parse: %s case %d", mode, n)
+			var perr *ParseError
+			if assert.Truef(errors.As(err, &perr), "Should report expected terminals: %s case %d", mode, n) {
+				assert.Equalf(tc.pos, perr.Pos(), "Fail %s case %d", mode, n)
+				assert.Equalf(tc.tokens[tc.pos], perr.Token(), "Fail %s case %d", mode, n)
+				assert.Equalf(tc.expect, perr.Expected(), "Fail %s case %d", mode, n)
+				nonTerm, ok := perr.NonTerm()
+				assert.Equalf(tc.nonTerm != nil, ok, "Fail %s case %d", mode, n)
+				if tc.nonTerm != nil {
+					assert.Equalf(*tc.nonTerm, nonTerm, "Fail %s case %d", mode, n)
+				}
+			}
+		}
+	}
+}
+
+func TestPEGParser_Cut(t *testing.T) {
+	assert := assert.New(t)
+
+	g := NewGrammarSymGenerator()
+
+	S := g.NonTerm()
+	eof := g.Term()
+
+	A := g.NonTerm()
+	X := g.NonTerm()
+	a := g.Term()
+	b := g.Term()
+	c := g.Term()
+
+	for n, tc := range []struct {
+		rules     []GrammarRule
+		tokens    []Token
+		backtrack string
+		strict    string
+	}{
+		{
+			rules: []GrammarRule{
+				NewGrammarRule(S, A),
+				NewGrammarRule(A, a, b),
+				NewGrammarRule(A, a, c),
+			},
+			tokens: []Token{
+				newToken(a.Kind(), "a"),
+				newToken(c.Kind(), "c"),
+				newToken(eof.Kind(), ""),
+			},
+			backtrack: "0(2(a c))",
+			strict:    "0(2(a c))",
+		},
+		{
+			// later rules are not tried once the cut is matched
+			rules: []GrammarRule{
+				NewGrammarRule(S, A),
+				NewGrammarRule(A, a, NewPEGCut(), b),
+				NewGrammarRule(A, a, c),
+			},
+			tokens: []Token{
+				newToken(a.Kind(), "a"),
+				newToken(c.Kind(), "c"),
+				newToken(eof.Kind(), ""),
+			},
+		},
+		{
+			rules: []GrammarRule{
+				NewGrammarRule(S, A),
+				NewGrammarRule(A, a, NewPEGCut(), b),
+				NewGrammarRule(A, c),
+			},
+			tokens: []Token{
+				newToken(c.Kind(), "c"),
+				newToken(eof.Kind(), ""),
+			},
+			backtrack: "0(2(c))",
+			strict:    "0(2(c))",
+		},
+		{
+			// symbols before the cut are not backtracked into
+			rules: []GrammarRule{
+				NewGrammarRule(S, A, a),
+				NewGrammarRule(A, X, NewPEGCut()),
+				NewGrammarRule(X, a, a),
+				NewGrammarRule(X, a),
+			},
+			tokens: []Token{
+				newToken(a.Kind(), "a"),
+				newToken(a.Kind(), "a"),
+				newToken(eof.Kind(), ""),
+			},
+		},
+		{
+			// symbols after the cut are still backtracked into
+			rules: []GrammarRule{
+				NewGrammarRule(S, A),
+				NewGrammarRule(A, a, NewPEGCut(), X, a),
+				NewGrammarRule(X, a, a),
+				NewGrammarRule(X, a),
+			},
+			tokens: []Token{
+				newToken(a.Kind(), "a"),
+				newToken(a.Kind(), "a"),
+				newToken(a.Kind(), "a"),
+				newToken(eof.Kind(), ""),
+			},
+			backtrack: "0(2(a 3(a) a))",
+		},
+	} {
+		for _, mode := range []PEGMode{PEGModeBacktrack, PEGModeStrict} {
+			exp := tc.backtrack
+			if mode == PEGModeStrict {
+				exp = tc.strict
+			}
+			parser, err := NewPEGParser(tc.rules, S, eof, PEGParserMode(mode))
+			assert.NoErrorf(err, "Failed to create parser: %s case %d", mode, n)
+			tree, err := parser.Parse(tc.tokens)
+			if exp == "" {
+				assert.Errorf(err, "Should fail to parse: %s case %d", mode, n)
+				assert.Truef(errors.Is(err, ErrParse), "Should fail to parse: %s case %d", mode, n)
+				continue
+			}
+			assert.NoErrorf(err, "Failed to parse: %s case %d, %v", mode, n, err)
+			assert.Equalf(exp, parseTreeString(tree), "Fail %s case %d", mode, n)
+		}
+	}
+
+	{
+		// matches before a cut are discarded once no stream may backtrack to
+		// them
+		rules := []GrammarRule{
+			NewGrammarRule(S, NewPEGZeroOrMore(A)),
+			NewGrammarRule(A, a, NewPEGCut(), X),
+			NewGrammarRule(A, c),
+			NewGrammarRule(X, b),
+		}
+		tokens := []Token{}
+		for i := 0; i < 1000; i++ {
+			tokens = append(tokens, newToken(a.Kind(), "a"), newToken(b.Kind(), "b"))
+		}
+		tokens = append(tokens, newToken(eof.Kind(), ""))
+		parser, err := NewPEGParser(rules, S, eof, PEGParserMode(PEGModeStrict))
+		assert.NoError(err, "Failed to create parser")
+		ps := parser.newParse(tokens)
+		m, ok, err := ps.match([]GrammarSym{S, eof})
+		assert.NoError(err, "Failed to parse")
+		assert.True(ok, "Failed to parse")
+		assert.Equal(len(tokens), m.end)
+		assert.Len(m.children.nodes()[0].Children(), 1000)
+		assert.LessOrEqual(len(ps.memo), 8, "Memo should be pruned")
+	}
+}
+
+func TestPEGParser_Predicate(t *testing.T) {
+	assert := assert.New(t)
+
+	g := NewGrammarSymGenerator()
+
+	S := g.NonTerm()
+	eof := g.Term()
+
+	Ident := g.NonTerm()
+	Keyword := g.NonTerm()
+	id := g.Term()
+	a := g.Term()
+	b := g.Term()
+
+	notKeyword := 0
+	afterA := 1
+	rules := []GrammarRule{
+		NewGrammarRule(S, Ident),
+		NewGrammarRule(S, Keyword),
+		NewGrammarRule(S, a, NewPEGPredicate(afterA), b),
+		NewGrammarRule(Ident, NewPEGPredicate(notKeyword), id),
+		NewGrammarRule(Keyword, id),
+	}
+	opts := []PEGParserOpt{
+		PEGParserPredicate(notKeyword, func(node *ParseTree, tokens []Token) bool {
+			return len(node.Children()) == 0 && tokens[0].Val() != "if"
+		}),
+		PEGParserPredicate(afterA, func(node *ParseTree, tokens []Token) bool {
+			children := node.Children()
+			return node.Kind() == S.Kind() && len(children) == 1 && children[0].Kind() == a.Kind() && tokens[0].Kind() == b.Kind()
+		}),
+	}
+
+	for n, tc := range []struct {
+		tokens []Token
+		exp    string
+	}{
+		{
+			tokens: []Token{
+				newToken(id.Kind(), "x"),
+				newToken(eof.Kind(), ""),
+			},
+			exp: "0(2(x))",
+		},
+		{
+			tokens: []Token{
+				newToken(id.Kind(), "if"),
+				newToken(eof.Kind(), ""),
+			},
+			exp: "0(3(if))",
+		},
+		{
+			tokens: []Token{
+				newToken(a.Kind(), "a"),
+				newToken(b.Kind(), "b"),
+				newToken(eof.Kind(), ""),
+			},
+			exp: "0(a b)",
+		},
+	} {
+		for _, mode := range []PEGMode{PEGModeBacktrack, PEGModeStrict} {
+			parser, err := NewPEGParser(rules, S, eof, append(opts, PEGParserMode(mode))...)
+			assert.NoErrorf(err, "Failed to create parser: %s case %d", mode, n)
+			tree, err := parser.Parse(tc.tokens)
+			assert.NoErrorf(err, "Failed to parse: %s case %d, %v", mode, n, err)
+			assert.Equalf(tc.exp, parseTreeString(tree), "Fail %s case %d", mode, n)
+		}
+	}
+
+	_, err := NewPEGParser(rules, S, eof, opts[0])
+	assert.True(errors.Is(err, ErrGrammar), "Undefined predicate should fail")
+
+	assert.Equal("~", NewPEGCut().String())
+	assert.Equal("&{1}", NewPEGPredicate(afterA).String())
+}